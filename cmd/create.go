@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"github.com/spf13/cobra"
+)
+
+var createType string
+var createContent string
+var createProxied bool
+var createPriority int
+
+func init() {
+	createCmd.PersistentFlags().StringSliceVarP(&zoneNames, "zone-name", "z", zoneNames, "Name of one or more Zones to create the DNS records in. When omitted, the zone is resolved from the fully qualified record names")
+	createCmd.PersistentFlags().StringSliceVarP(&recordNames, "dns-record-names", "r", recordNames, "Name of one or more DNS records. If more than one record is specified separated them with a comma")
+	createCmd.PersistentFlags().StringVarP(&createType, "type", "", string(dns.AType), "Type of the DNS records to create")
+	createCmd.PersistentFlags().StringVarP(&createContent, "content", "", "", "Content of the DNS records. For A and AAAA records the public ip is used when omitted")
+	createCmd.PersistentFlags().IntVarP(&ttlInSeconds, "ttl", "", 3600, "TTL (in seconds) to set on the DNS record")
+	createCmd.PersistentFlags().BoolVarP(&createProxied, "proxied", "", false, "Whether the DNS records are proxied by Cloudflare")
+	createCmd.PersistentFlags().IntVarP(&createPriority, "priority", "", dns.DefaultPriority, "Priority of MX, SRV and URI records")
+
+	createCmd.MarkPersistentFlagRequired("dns-record-names")
+	addLookupFlags(createCmd)
+	rootCmd.AddCommand(createCmd)
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create",
+	Short: "create the DNS records with <dns-record-names>",
+	Long: `Create the DNS records with <dns-record-names> in the given zones. Records that already exist with the same
+name and type are reported as errors and left as is`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
+		client, err := createClient()
+		if err != nil {
+			return err
+		}
+
+		t, err := dns.ParseZoneType(createType)
+		if err != nil {
+			return err
+		}
+		records, err := recordsFromFlags(ctx, client, zoneNames, recordNames, []dns.ZoneType{t})
+		if err != nil {
+			return err
+		}
+
+		var result summary
+		for _, record := range records {
+			if t.IsAddress() {
+				record.IP = createContent
+			} else {
+				record.Content = createContent
+			}
+			record.Proxied = &createProxied
+			record.Priority = &createPriority
+
+			created, err := createRecord(ctx, client, record)
+			result.Add(createResult(record, created, err), err)
+		}
+
+		if err := result.Write(os.Stdout, outputFormat); err != nil {
+			return err
+		}
+		return result.Err("create")
+	},
+}
+
+// createResult returns the result of creating the record
+func createResult(record dns.Record, created *model.DNSRecord, err error) recordResult {
+	result := recordResult{Zone: record.ZoneName, Name: record.Name, Type: string(record.Type), Action: string(dns.ActionCreate)}
+	if err != nil {
+		result.Action = actionFailed
+		result.Error = err.Error()
+	} else if created != nil {
+		result.NewContent = created.Content
+	}
+
+	return result
+}
+
+// createRecord creates the record only when no record with the same name and type exists
+func createRecord(ctx context.Context, client dns.DNSClient, record dns.Record) (*model.DNSRecord, error) {
+	_, err := dns.FindRecord(ctx, client, record)
+	if err == nil {
+		return nil, fmt.Errorf("%s %s: %w", record.Type, record.Name, dns.ErrRecordExists)
+	} else if !errors.Is(err, dns.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return dns.CreateRecord(ctx, client, record)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/metrics"
+	"github.com/spf13/cobra"
+)
+
+var pollInterval time.Duration
+var metricsListen string
+
+func init() {
+	daemonCmd.PersistentFlags().StringSliceVarP(&zoneNames, "zone-name", "z", zoneNames, "Name of one or more Zones the DNS records reside in. When omitted, the zone is resolved from the fully qualified record names")
+	daemonCmd.PersistentFlags().IntVarP(&ttlInSeconds, "ttl", "", 3600, "TTL (in seconds) to set on the DNS record")
+	daemonCmd.PersistentFlags().StringSliceVarP(&recordNames, "dns-record-names", "r", recordNames, "Name of one or more DNS records. If more than one record is specified separated them with a comma")
+	daemonCmd.PersistentFlags().StringSliceVarP(&recordTypes, "type", "", recordTypes, "Type of the DNS records to keep updated, either A, AAAA or A,AAAA to keep both records in sync")
+	daemonCmd.PersistentFlags().DurationVarP(&pollInterval, "interval", "", 5*time.Minute, "How often the public ip is checked for changes")
+
+	daemonCmd.PersistentFlags().StringVarP(&metricsListen, "metrics-listen", "", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9101. Metrics are not served when empty")
+
+	daemonCmd.MarkPersistentFlagRequired("dns-record-names")
+	addLookupFlags(daemonCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep the DNS records in the given zones updated with the public IP",
+	Long: `Runs until it receives SIGINT or SIGTERM. The public ip is checked every <interval> and the DNS records
+are only updated when the ip changes. The ip is cached by the retriever, so an interval shorter than the
+cache TTL will not result in more lookups. The --timeout applies to every check, and requests that are in flight
+are cancelled on shutdown`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pollInterval <= 0 {
+			return fmt.Errorf("interval must be greater than zero")
+		}
+
+		types, err := parseAddressTypes(recordTypes)
+		if err != nil {
+			return err
+		}
+
+		client, err := createClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := runContext(cmd.Context())
+		records, err := recordsFromFlags(ctx, client, zoneNames, recordNames, types)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if metricsListen != "" {
+			listener, err := net.Listen("tcp", metricsListen)
+			if err != nil {
+				return fmt.Errorf("failed to listen for metrics on %s: %w", metricsListen, err)
+			}
+			slog.Info("Serving metrics", "address", listener.Addr().String())
+			go func() {
+				if err := metrics.Serve(cmd.Context(), listener); err != nil {
+					slog.Error("Failed to serve metrics", "address", metricsListen, "error", err)
+				}
+			}()
+		}
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		lastIPs := make(map[dns.ZoneType]string)
+		for {
+			ctx, cancel := runContext(cmd.Context())
+			var syncErr error
+			for _, t := range types {
+				var err error
+				if lastIPs[t], err = syncRecords(ctx, client, records, t, lastIPs[t]); err != nil {
+					syncErr = err
+				}
+			}
+			cancel()
+			metrics.ObserveRun(syncErr)
+
+			select {
+			case <-cmd.Context().Done():
+				slog.Info("Received shutdown signal. Shutting down")
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// syncRecords updates all the given records of type t when the external ip differs from lastIP. The ip the records
+// were updated with is returned. If any record failed to update, lastIP is returned with the error so that the update
+// is retried on the next tick.
+func syncRecords(ctx context.Context, client dns.DNSClient, records []dns.Record, t dns.ZoneType, lastIP string) (string, error) {
+	ip, err := dns.ExternalIP(ctx, client, t)
+	if err != nil {
+		slog.Error("Failed to get external ip", "type", t, "error", err)
+		return lastIP, err
+	}
+
+	if ip == lastIP {
+		return lastIP, nil
+	}
+
+	slog.Info("External ip changed", "type", t, "old_ip", lastIP, "ip", ip)
+
+	var syncErr error
+	for _, record := range records {
+		if record.Type != t {
+			continue
+		}
+
+		record.IP = ip
+		if _, err := dns.UpdateRecord(ctx, client, record); err != nil {
+			syncErr = err
+			slog.Error("Failed to update DNS record", "zone", record.ZoneName, "record", record.Name, "type", t, "ip", ip, "error", err)
+		}
+	}
+
+	if syncErr != nil {
+		return lastIP, syncErr
+	}
+
+	return ip, nil
+}
@@ -1,18 +1,24 @@
 package cmd
 
 import (
-	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/burmudar/cloudflare-dns/dns"
 	"github.com/spf13/cobra"
 )
 
+// actionDelete is the action of records that were deleted
+const actionDelete = "delete"
+
+var deleteTypes []string = []string{string(dns.AType)}
+
 func init() {
-	deleteCmd.PersistentFlags().StringVarP(&zoneName, "zone-name", "z", "", "Name of the Zone the DNS record resides in")
+	deleteCmd.PersistentFlags().StringSliceVarP(&zoneNames, "zone-name", "z", zoneNames, "Name of one or more Zones the DNS records reside in. When omitted, the zone is resolved from the fully qualified record names")
 	deleteCmd.PersistentFlags().StringSliceVarP(&recordNames, "dns-record-name", "r", recordNames, "Name of the DNS record")
+	deleteCmd.PersistentFlags().StringSliceVarP(&deleteTypes, "type", "", deleteTypes, "Type of the DNS records to delete")
 
-	deleteCmd.MarkPersistentFlagRequired("zone-name")
 	deleteCmd.MarkPersistentFlagRequired("dns-record-name")
 	rootCmd.AddCommand(deleteCmd)
 }
@@ -22,31 +28,42 @@ var deleteCmd = &cobra.Command{
 	Short: "delete the DNS record with <dns-record-name>",
 	Long:  `Delete the DNS record with <dns-record-name> that is inside zone with <zone-name>`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
 		client, err := createClient()
 		if err != nil {
 			return err
 		}
 
-		hasErrs := false
+		types := make([]dns.ZoneType, 0, len(deleteTypes))
+		for _, t := range deleteTypes {
+			types = append(types, dns.ZoneType(strings.ToUpper(strings.TrimSpace(t))))
+		}
+
+		records, err := recordsFromFlags(ctx, client, zoneNames, recordNames, types)
+		if err != nil {
+			return err
+		}
 
-		for _, name := range recordNames {
-			result, err := dns.DeleteRecord(client, dns.Record{
-				ZoneName: zoneName,
-				Name:     dns.NormaliseRecordName(zoneName, name),
-			})
+		var result summary
+		for _, record := range records {
+			deleted, err := dns.DeleteRecord(ctx, client, record)
 
+			r := recordResult{Zone: record.ZoneName, Name: record.Name, Type: string(record.Type), Action: actionDelete}
 			if err != nil {
-				hasErrs = true
-				fmt.Fprintf(os.Stderr, "error deleting dns record %s. %v", name, err)
+				r.Action = actionFailed
+				r.Error = err.Error()
 			} else {
-				fmt.Fprintf(os.Stderr, "--- DNS '%s' record deleted ---\n%s\n", name, result)
+				r.OldContent = deleted.Content
+				slog.Info("Deleted DNS record", "zone", record.ZoneName, "record", deleted.Name, "type", deleted.Type, "content", deleted.Content, "action", actionDelete)
 			}
+			result.Add(r, err)
 		}
 
-		if hasErrs {
-			return fmt.Errorf("One or more records failed to delete")
+		if err := result.Write(os.Stdout, outputFormat); err != nil {
+			return err
 		}
-
-		return nil
+		return result.Err("delete")
 	},
 }
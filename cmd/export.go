@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/zonefile"
+	"github.com/spf13/cobra"
+)
+
+var exportZone string
+var exportFile string
+
+func init() {
+	exportCmd.PersistentFlags().StringVarP(&exportZone, "zone-name", "z", "", "Name of the Zone to export")
+	exportCmd.PersistentFlags().StringVarP(&exportFile, "file", "f", "", "File the zone is written to. The zone is written to stdout when omitted")
+
+	exportCmd.MarkPersistentFlagRequired("zone-name")
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export the DNS records of the zone <zone-name> to a BIND zone file",
+	Long: `All the DNS records of the zone are written as an RFC 1035 zone file, which can be kept as a backup or
+loaded into another DNS provider. The proxied status and automatic TTLs of records are kept as comments. The
+zone file has no SOA record, since Cloudflare manages it. The --output flag does not apply to this command`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
+		client, err := createClient()
+		if err != nil {
+			return err
+		}
+
+		records, err := dns.ListRecords(ctx, client, exportZone)
+		if err != nil {
+			return fmt.Errorf("error listing records in zone %s: %w", exportZone, err)
+		}
+
+		if exportFile == "" {
+			return zonefile.Write(os.Stdout, exportZone, records)
+		}
+
+		f, err := os.Create(exportFile)
+		if err != nil {
+			return err
+		}
+		if err := zonefile.Write(f, exportZone, records); err != nil {
+			f.Close()
+			return fmt.Errorf("error writing zone %s to %s: %w", exportZone, exportFile, err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		slog.Info("Exported zone", "zone", exportZone, "records", len(records), "file", exportFile)
+		return nil
+	},
+}
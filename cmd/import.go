@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/zonefile"
+	"github.com/spf13/cobra"
+)
+
+// Actions of records that are not imported
+const (
+	// actionConflict is the action of records that conflict with the records in the zone
+	actionConflict = "conflict"
+	// actionSkipped is the action of records that are not imported because other records conflict
+	actionSkipped = "skipped"
+)
+
+var importZone string
+var importFile string
+var importReplace bool
+var importForceOrigin bool
+
+func init() {
+	importCmd.PersistentFlags().StringVarP(&importZone, "zone-name", "z", "", "Name of the Zone to import the records into")
+	importCmd.PersistentFlags().StringVarP(&importFile, "file", "f", "", "Zone file to import. Use - to read the zone file from stdin")
+	importCmd.PersistentFlags().BoolVarP(&importReplace, "replace", "", false, "Update existing records with the same name and type but different content, instead of reporting them as conflicts")
+	importCmd.PersistentFlags().BoolVarP(&importForceOrigin, "force-origin", "", false, "Ignore $ORIGIN in the zone file and qualify relative names with the zone name, to import a zone exported from another domain")
+	importCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "Show which records would be created, updated, left unchanged or conflict without changing anything")
+
+	importCmd.MarkPersistentFlagRequired("zone-name")
+	importCmd.MarkPersistentFlagRequired("file")
+	addLookupFlags(importCmd)
+	rootCmd.AddCommand(importCmd)
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "import the records of a BIND zone file into the zone <zone-name>",
+	Long: `The records of the zone file are compared to the records in the zone by name, type and content. Records that
+do not exist are created, records with a different TTL, priority or proxied status are updated and the other
+records are left unchanged. Records that are only in the zone are left as is.
+
+A record conflicts when a record with the same name and type but different content exists, unless --replace is
+given, when a CNAME record would exist next to other records, when it is not in the zone or when its content is
+invalid. Without --replace nothing is imported when any record conflicts. With --replace the import is partial:
+records with different content are updated, the records that still conflict are reported and skipped and the
+other records are imported`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
+		client, err := createClient()
+		if err != nil {
+			return err
+		}
+
+		records, err := readZoneFile(importFile)
+		if err != nil {
+			return err
+		}
+
+		changes, conflicts, err := zonefile.PlanImport(ctx, client, importZone, records, zonefile.ImportOptions{Replace: importReplace})
+		if err != nil {
+			return err
+		}
+
+		// without --replace the zone is only changed when every record can be imported, so that a conflict never
+		// leaves the zone with half of the zone file
+		refused := len(conflicts) > 0 && !importReplace
+		var result summary
+		for _, change := range changes {
+			var err error
+			if !dryRun && !refused {
+				_, err = dns.ApplyChange(ctx, client, change)
+			}
+			r := changeResult(change.Record, change, err)
+			if !dryRun && refused {
+				r.Action = actionSkipped
+			}
+			result.Add(r, err)
+		}
+		for _, err := range conflicts {
+			var conflict *zonefile.ConflictError
+			if !errors.As(err, &conflict) {
+				return err
+			}
+			r := changeResult(conflict.Record, nil, err)
+			r.Action = actionConflict
+			result.Add(r, err)
+		}
+
+		if dryRun && outputFormat == outputTable {
+			zonefile.WritePlan(os.Stdout, changes, conflicts)
+		} else if err := result.Write(os.Stdout, outputFormat); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return result.Err("plan")
+		}
+		if refused {
+			return fmt.Errorf("no records were imported, use --replace to import the records that do not conflict: %w", result.Err("import"))
+		}
+		return result.Err("import")
+	},
+}
+
+// readZoneFile parses the zone file at path, or stdin when path is '-'
+func readZoneFile(path string) ([]dns.Record, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	records, err := zonefile.Parse(r, zonefile.ParseOptions{Origin: importZone, ForceOrigin: importForceOrigin})
+	if err != nil {
+		return nil, fmt.Errorf("error reading zone file %s: %w", path, err)
+	}
+
+	return records, nil
+}
@@ -2,38 +2,55 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
 
 	"github.com/spf13/cobra"
 )
 
+var listColumns []string = []string{"type", "name", "content", "ttl", "proxied"}
+
 func init() {
-	listRecordCmd.PersistentFlags().StringVarP(&zoneName, "zone-name", "z", "", "Name of the Zone the DNS record resides in")
+	listRecordCmd.PersistentFlags().StringSliceVarP(&zoneNames, "zone-name", "z", zoneNames, "Name of one or more Zones to list the DNS records of")
+	listRecordCmd.PersistentFlags().StringSliceVarP(&listColumns, "columns", "", listColumns, "Columns shown in table and csv output, from: "+strings.Join(columnNames(recordColumns), ", "))
 
+	listRecordCmd.MarkPersistentFlagRequired("zone-name")
 	rootCmd.AddCommand(listRecordCmd)
 }
 
 var listRecordCmd = &cobra.Command{
 	Use:   "list-records",
-	Short: "list DNS records present in zone <zoneName>",
-	Long:  `Using the <zoneName> all the DNS records registered for the zone are fetched`,
+	Short: "list DNS records present in the zones <zoneName>",
+	Long: `Using the <zoneName> all the DNS records registered for the zone are fetched. Multiple zones can be listed at once.
+The records of all the zones are printed as one table, or as one list with --output json, yaml or csv`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
 		client, err := createClient()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to create cloudflare client: %v", err)
+			return fmt.Errorf("failed to create cloudflare client: %w", err)
 		}
 
-		fmt.Fprintf(os.Stderr, "--- Listing records in zone '%s' ---\n", zoneName)
-		records, err := dns.ListRecords(client, zoneName)
+		columns, err := selectColumns(recordColumns, listColumns)
 		if err != nil {
 			return err
 		}
-		for _, record := range records {
-			fmt.Fprintf(os.Stdout, "--- %s ---\n%s\n", record.Name, record.String())
+
+		var all []*model.DNSRecord
+		for _, zoneName := range zoneNames {
+			slog.Debug("Listing records", "zone", zoneName)
+			records, err := dns.ListRecords(ctx, client, zoneName)
+			if err != nil {
+				return fmt.Errorf("error listing records in zone %s: %w", zoneName, err)
+			}
+			all = append(all, records...)
 		}
 
-		return nil
+		return writeOutput(os.Stdout, outputFormat, all, columns)
 	},
 }
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Values of --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputCSV   = "csv"
+)
+
+// validateOutputFormat returns an error when format is not one of the supported output formats
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML, outputCSV:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format '%s'. Use table, json, yaml or csv", format)
+	}
+}
+
+// column is a named value of T shown in table and csv output
+type column[T any] struct {
+	name  string
+	value func(T) string
+}
+
+// writeOutput writes the items to w in the given format. JSON and YAML contain all the fields of the items, while
+// tables and csv only contain the given columns
+func writeOutput[T any](w io.Writer, format string, items []T, columns []column[T]) error {
+	if items == nil {
+		items = []T{}
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(items); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = c.name
+		}
+		cw.Write(header)
+		for _, item := range items {
+			cw.Write(columnValues(item, columns))
+		}
+		cw.Flush()
+		return cw.Error()
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		header := make([]string, len(columns))
+		for i, c := range columns {
+			header[i] = strings.ToUpper(c.name)
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, item := range items {
+			fmt.Fprintln(tw, strings.Join(columnValues(item, columns), "\t"))
+		}
+		return tw.Flush()
+	default:
+		return validateOutputFormat(format)
+	}
+}
+
+func columnValues[T any](item T, columns []column[T]) []string {
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		values[i] = c.value(item)
+	}
+
+	return values
+}
+
+// selectColumns returns the columns with the given names in the given order
+func selectColumns[T any](available []column[T], names []string) ([]column[T], error) {
+	selected := make([]column[T], 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, c := range available {
+			if c.name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column '%s'. Available columns: %s", name, strings.Join(columnNames(available), ", "))
+		}
+	}
+
+	return selected, nil
+}
+
+func columnNames[T any](columns []column[T]) []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+
+	return names
+}
+
+// recordColumns are the columns of DNS records that can be selected with --columns
+var recordColumns = []column[*model.DNSRecord]{
+	{"id", func(r *model.DNSRecord) string { return r.ID }},
+	{"zone_id", func(r *model.DNSRecord) string { return r.ZoneID }},
+	{"zone", func(r *model.DNSRecord) string { return r.ZoneName }},
+	{"name", func(r *model.DNSRecord) string { return r.Name }},
+	{"type", func(r *model.DNSRecord) string { return r.Type }},
+	{"content", func(r *model.DNSRecord) string { return r.Content }},
+	{"ttl", func(r *model.DNSRecord) string { return strconv.Itoa(r.TTL) }},
+	{"priority", func(r *model.DNSRecord) string {
+		if r.Priority == nil {
+			return ""
+		}
+		return strconv.Itoa(*r.Priority)
+	}},
+	{"proxied", func(r *model.DNSRecord) string { return strconv.FormatBool(r.Proxied) }},
+	{"proxiable", func(r *model.DNSRecord) string { return strconv.FormatBool(r.Proxiable) }},
+	{"locked", func(r *model.DNSRecord) string { return strconv.FormatBool(r.Locked) }},
+	{"created", func(r *model.DNSRecord) string { return formatTime(r.Created) }},
+	{"modified", func(r *model.DNSRecord) string { return formatTime(r.Modified) }},
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// recordResult is the outcome of a command for a single record
+type recordResult struct {
+	Zone       string `json:"zone" yaml:"zone"`
+	Name       string `json:"name" yaml:"name"`
+	Type       string `json:"type" yaml:"type"`
+	Action     string `json:"action" yaml:"action"`
+	OldContent string `json:"old_content" yaml:"old_content"`
+	NewContent string `json:"new_content" yaml:"new_content"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// actionFailed is the action of records that failed
+const actionFailed = "failed"
+
+// changeResult returns the result of applying the change to the record
+func changeResult(record dns.Record, change *dns.Change, err error) recordResult {
+	result := recordResult{Zone: record.ZoneName, Name: record.Name, Type: string(record.Type)}
+	if change != nil {
+		result.Action = string(change.Action)
+		if change.Current != nil {
+			result.OldContent = change.Current.Content
+			result.NewContent = change.Current.Content
+		}
+		if change.Request != nil {
+			result.NewContent = change.Request.Content
+		}
+	}
+
+	if err != nil {
+		result.Action = actionFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+var resultColumns = []column[recordResult]{
+	{"action", func(r recordResult) string { return r.Action }},
+	{"type", func(r recordResult) string { return r.Type }},
+	{"name", func(r recordResult) string { return r.Name }},
+	{"old_content", func(r recordResult) string { return r.OldContent }},
+	{"new_content", func(r recordResult) string { return r.NewContent }},
+	{"error", func(r recordResult) string { return r.Error }},
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+)
+
+// recordsFromFlags creates a record for every name and type combination. Names that are fully qualified for one
+// of the given zones are used as is. Other names are expanded with the zone when a single zone is given, and are
+// an error with more than one zone, since it is ambiguous which zone is meant. When no zones are given, names must
+// be fully qualified and their zone is resolved from the zones available to the client
+func recordsFromFlags(ctx context.Context, client dns.DNSClient, zones []string, names []string, types []dns.ZoneType) ([]dns.Record, error) {
+	var records []dns.Record
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		zone, err := zoneForName(zones, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range types {
+			records = append(records, dns.Record{
+				ZoneName: zone,
+				Type:     t,
+				Name:     fqdn(zone, name),
+				TTL:      ttlInSeconds,
+				IP:       manualIP,
+			})
+		}
+	}
+
+	return dns.ResolveRecordZones(ctx, client, records)
+}
+
+// zoneForName returns the zone the name is qualified for, or the only zone. When there are no zones an empty zone
+// is returned, which means the zone still needs to be resolved
+func zoneForName(zones []string, name string) (string, error) {
+	if len(zones) == 0 {
+		return "", nil
+	}
+
+	for _, z := range zones {
+		if name == z || strings.HasSuffix(name, "."+z) {
+			return z, nil
+		}
+	}
+
+	if len(zones) > 1 {
+		return "", fmt.Errorf("record %s is not fully qualified for any of the zones %s. Use the fully qualified name when more than one zone is given", name, strings.Join(zones, ", "))
+	}
+
+	return zones[0], nil
+}
+
+func fqdn(zone, name string) string {
+	if zone == "" {
+		return name
+	}
+
+	return dns.NormaliseRecordName(zone, name)
+}
+
+// summary collects the outcome of every record processed in a run so that it can be reported once at the end
+type summary struct {
+	results  []recordResult
+	failed   int
+	firstErr error
+}
+
+// Add adds the result of a record. Failed records are logged as they happen
+func (s *summary) Add(result recordResult, err error) {
+	s.results = append(s.results, result)
+	if err != nil {
+		if s.firstErr == nil {
+			s.firstErr = err
+		}
+		s.failed++
+		slog.Error("Failed to process DNS record", "zone", result.Zone, "record", result.Name, "type", result.Type, "error", err)
+	}
+}
+
+// Write writes the results of all the records to w in the given output format
+func (s *summary) Write(w io.Writer, format string) error {
+	slog.Info("Finished processing records", "total", len(s.results), "succeeded", len(s.results)-s.failed, "failed", s.failed)
+	return writeOutput(w, format, s.results, resultColumns)
+}
+
+// Err returns an error when any of the records failed. The error of the first record that failed is wrapped, so
+// that the exit code can be chosen from it
+func (s *summary) Err(action string) error {
+	if s.failed > 0 {
+		return fmt.Errorf("%d of %d records failed to %s: %w", s.failed, len(s.results), action, s.firstErr)
+	}
+
+	return nil
+}
@@ -1,40 +1,248 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/burmudar/cloudflare-dns/dns"
 	"github.com/burmudar/cloudflare-dns/dns/cloudflare"
+	"github.com/burmudar/cloudflare-dns/metrics"
+	"github.com/burmudar/cloudflare-dns/retrievers"
 	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var tokenPath string
-var zoneName string
+var zoneNames []string = make([]string, 0)
 var recordNames []string = make([]string, 0)
+var recordTypes []string = []string{string(dns.AType)}
 var manualIP string
 var ttlInSeconds int
+var configPath string
+var dryRun bool
+var createMissing bool
+var pageSize int
+var retries int
+var timeout time.Duration
+var ipURLs []string
+var ipv6URLs []string
+var quorum int
+var ipFormat string
+var ipJSONPath string
+var ipRegex string
+var ipSource string
+var stunServers []string
+var dnsProvider string
+var dnsResolvers []string
+var bindAddresses []string
+var bindInterface string
+var metricsTextfile string
+var logFormat string
+var logLevel string
+var outputFormat string
 
 var rootCmd = &cobra.Command{
 	Use:   "cloudfare-dns",
 	Short: "Cloudfare DNS updates specific dns records with public ips",
 	Long: `A Personal utility used by @burmudar to update various machines he has in his apartment
                 Code at github.com/burmudar/cloudflare-dns-ip`,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger, err := newLogger(os.Stderr, logFormat, logLevel)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(logger)
+
+		outputFormat = strings.ToLower(strings.TrimSpace(outputFormat))
+		return validateOutputFormat(outputFormat)
+	},
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&tokenPath, "token", "t", "", "Cloudflare API token file")
+	rootCmd.PersistentFlags().IntVarP(&pageSize, "page-size", "", cloudflare.DefaultPageSize, "Number of zones or records requested per page from the Cloudflare API")
+	rootCmd.PersistentFlags().IntVarP(&retries, "retries", "", cloudflare.DefaultRetryPolicy.MaxAttempts-1, "Number of times a Cloudflare API request is retried after a network error, 5xx or 429 response")
+	rootCmd.PersistentFlags().DurationVarP(&timeout, "timeout", "", 5*time.Minute, "Maximum duration of a run, after which all requests are cancelled. The daemon applies the timeout to every check. 0 disables the timeout")
+	rootCmd.PersistentFlags().StringVarP(&metricsTextfile, "metrics-textfile", "", "", "Write the metrics of the run to this file for the node_exporter textfile collector. The file name must end in .prom")
+	rootCmd.PersistentFlags().StringVarP(&logFormat, "log-format", "", logFormatText, "Format of the logs written to stderr: text or json")
+	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "", "info", "Minimum level of the logs written to stderr: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "Format of the results printed to stdout: table, json, yaml or csv")
 	rootCmd.MarkPersistentFlagRequired("token")
 }
 
+// addLookupFlags adds the flags that configure how the public ip is discovered to a command that looks it up
+func addLookupFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSliceVarP(&ipURLs, "ip-url", "", retrievers.DefaultIPv4URLs, "Endpoints that return the public IPv4 address in --ip-format. They are queried concurrently and in order when an endpoint fails or disagrees")
+	cmd.PersistentFlags().StringSliceVarP(&ipv6URLs, "ipv6-url", "", retrievers.DefaultIPv6URLs, "Endpoints that return the public IPv6 address in --ip-format")
+	cmd.PersistentFlags().IntVarP(&quorum, "quorum", "", retrievers.DefaultQuorum, "Number of endpoints that have to return the same ip before it is used")
+	cmd.PersistentFlags().StringVarP(&ipFormat, "ip-format", "", retrievers.FormatText, "Format of the responses of the --ip-url and --ipv6-url endpoints: text, json or regex")
+	cmd.PersistentFlags().StringVarP(&ipJSONPath, "ip-json-path", "", "", "Dot separated path to the ip in the responses with --ip-format json, e.g. ip or addresses.0.value")
+	cmd.PersistentFlags().StringVarP(&ipRegex, "ip-regex", "", "", "Regular expression that matches the ip in the responses with --ip-format regex. The first capture group is used when it has one")
+	cmd.PersistentFlags().StringVarP(&ipSource, "ip-source", "", ipSourceHTTP, "How the public ip is discovered: http, dns, stun or gateway")
+	cmd.PersistentFlags().StringSliceVarP(&stunServers, "stun-server", "", retrievers.DefaultSTUNServers, "STUN servers used by --ip-source stun, queried in order")
+	cmd.PersistentFlags().StringVarP(&dnsProvider, "dns-provider", "", retrievers.OpenDNS.Name, "DNS provider queried by --ip-source dns: opendns or cloudflare")
+	cmd.PersistentFlags().StringSliceVarP(&dnsResolvers, "dns-resolver", "", nil, "Resolvers queried by --ip-source dns instead of the default resolvers of --dns-provider. The port defaults to 53")
+	cmd.PersistentFlags().StringSliceVarP(&bindAddresses, "bind-address", "", nil, "Local IPv4 and/or IPv6 address HTTP ip lookups connect from, to report the ip of a specific uplink")
+	cmd.PersistentFlags().StringVarP(&bindInterface, "bind-interface", "", "", "Network interface HTTP ip lookups are bound to. Only supported on Linux")
+}
+
 func createClient() (dns.DNSClient, error) {
 	token, err := readTokenFile(tokenPath)
 	if err != nil {
 		return nil, err
 	}
 
-	return cloudflare.NewTokenClient(cloudflare.API_CLOUDFLARE_V4, string(token))
+	retryPolicy := cloudflare.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = retries + 1
+
+	ipv4Retriever, ipv6Retriever, err := externalIPRetrievers()
+	if err != nil {
+		return nil, err
+	}
+
+	source := strings.ToLower(ipSource)
+	ipv6Source := source
+	if source == ipSourceGateway {
+		ipv6Source = ipSourceHTTP
+	}
+	ipv4Retriever = retrievers.Instrument(source, retrievers.IPv4, ipv4Retriever)
+	ipv6Retriever = retrievers.Instrument(ipv6Source, retrievers.IPv6, ipv6Retriever)
+
+	return cloudflare.NewTokenClient(cloudflare.API_CLOUDFLARE_V4, string(token),
+		cloudflare.WithPageSize(pageSize),
+		cloudflare.WithRetryPolicy(retryPolicy),
+		cloudflare.WithIPRetrievers(ipv4Retriever, ipv6Retriever),
+	)
+}
+
+// Values of --ip-source
+const (
+	ipSourceHTTP    = "http"
+	ipSourceDNS     = "dns"
+	ipSourceSTUN    = "stun"
+	ipSourceGateway = "gateway"
+)
+
+// externalIPRetrievers creates the retrievers used to discover the public IPv4 and IPv6 addresses, as selected
+// with --ip-source
+func externalIPRetrievers() (retrievers.StringRetriever, retrievers.StringRetriever, error) {
+	switch strings.ToLower(ipSource) {
+	case ipSourceHTTP:
+		return httpIPRetrievers()
+	case ipSourceDNS:
+		provider, ok := retrievers.DNSProviders[strings.ToLower(strings.TrimSpace(dnsProvider))]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown dns provider '%s'. Use opendns or cloudflare", dnsProvider)
+		}
+		return retrievers.NewDNSRetriever(provider, retrievers.IPv4, dnsResolvers...),
+			retrievers.NewDNSRetriever(provider, retrievers.IPv6, dnsResolvers...),
+			nil
+	case ipSourceSTUN:
+		return retrievers.NewSTUNRetriever(retrievers.IPv4, stunServers...),
+			retrievers.NewSTUNRetriever(retrievers.IPv6, stunServers...),
+			nil
+	case ipSourceGateway:
+		// the router only knows its IPv4 WAN address, so the IPv6 address is still discovered with the HTTP endpoints
+		_, ipv6Retriever, err := httpIPRetrievers()
+		if err != nil {
+			return nil, nil, err
+		}
+		return retrievers.NewGatewayRetriever(""), ipv6Retriever, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported ip source '%s'. Use http, dns, stun or gateway", ipSource)
+	}
+}
+
+// httpIPRetrievers creates the retrievers that discover the public IPv4 and IPv6 addresses with the --ip-url and
+// --ipv6-url endpoints
+func httpIPRetrievers() (retrievers.StringRetriever, retrievers.StringRetriever, error) {
+	parser, err := retrievers.NewResponseParser(ipFormat, ipJSONPath, ipRegex)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --ip-format: %w", err)
+	}
+	ipv4Client, ipv6Client, err := lookupHTTPClients()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return consensusRetriever(ipv4Client, ipURLs, parser, retrievers.IPv4, "ip-url"),
+		consensusRetriever(ipv6Client, ipv6URLs, parser, retrievers.IPv6, "ipv6-url"),
+		nil
+}
+
+// consensusRetriever creates the retriever that discovers the ip of the family with the endpoints of flag. When
+// there are fewer endpoints than --quorum, only lookups of the family fail, so that a run that only updates A
+// records does not need enough IPv6 endpoints
+func consensusRetriever(client *http.Client, urls []string, parser retrievers.ResponseParser, family retrievers.Family, flag string) retrievers.StringRetriever {
+	if len(urls) < quorum {
+		return &failingRetriever{err: fmt.Errorf("a quorum of %d requires at least %d --%s endpoints to look up the %s address, but %d are given", quorum, quorum, flag, family, len(urls))}
+	}
+
+	return retrievers.NewConsensusParsedURLRetriever(client, urls, parser, family, quorum, 30*time.Second)
+}
+
+// failingRetriever fails every lookup with err
+type failingRetriever struct {
+	err error
+}
+
+func (r *failingRetriever) Get(ctx context.Context) (string, error) {
+	return "", r.err
+}
+
+// lookupHTTPClients creates the clients used for HTTP lookups of the IPv4 and IPv6 address. Every client only
+// connects over its family, from the --bind-address of that family and bound to --bind-interface
+func lookupHTTPClients() (*http.Client, *http.Client, error) {
+	ipv4Opts := retrievers.DialOptions{Family: retrievers.IPv4, Interface: bindInterface}
+	ipv6Opts := retrievers.DialOptions{Family: retrievers.IPv6, Interface: bindInterface}
+	for _, a := range bindAddresses {
+		addr, err := netip.ParseAddr(strings.TrimSpace(a))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid bind address '%s': %w", a, err)
+		}
+
+		addr = addr.Unmap()
+		if addr.Is4() {
+			ipv4Opts.LocalAddr = addr
+		} else {
+			ipv6Opts.LocalAddr = addr
+		}
+	}
+
+	ipv4Client, err := retrievers.NewHTTPClient(ipv4Opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	ipv6Client, err := retrievers.NewHTTPClient(ipv6Opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ipv4Client, ipv6Client, nil
+}
+
+// parseAddressTypes converts the given types to ZoneTypes, only A and AAAA are allowed
+func parseAddressTypes(types []string) ([]dns.ZoneType, error) {
+	result := make([]dns.ZoneType, 0, len(types))
+	for _, t := range types {
+		zt := dns.ZoneType(strings.ToUpper(strings.TrimSpace(t)))
+		if zt != dns.AType && zt != dns.AAAAType {
+			return nil, fmt.Errorf("unsupported record type '%s'. Only A and AAAA records are supported", t)
+		}
+		result = append(result, zt)
+	}
+
+	return result, nil
 }
 
 func readTokenFile(path string) ([]byte, error) {
@@ -51,9 +259,60 @@ func readTokenFile(path string) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+// Exit codes used when a command fails, so that scripts and systemd can tell failures apart
+const (
+	exitError       = 1
+	exitAuth        = 3
+	exitNotFound    = 4
+	exitRateLimited = 5
+	exitConflict    = 6
+)
+
+// exitCodeFor returns the exit code for the error together with a hint on how the error can be resolved
+func exitCodeFor(err error) (int, string) {
+	switch {
+	case errors.Is(err, cloudflare.ErrUnauthorized):
+		return exitAuth, "Cloudflare rejected the API token. Check that the token file contains a valid token with Zone:Read and DNS:Edit permissions"
+	case errors.Is(err, cloudflare.ErrRateLimited):
+		return exitRateLimited, "Cloudflare is rate limiting requests. Wait a few minutes before trying again"
+	case errors.Is(err, cloudflare.ErrConflict):
+		return exitConflict, "A conflicting DNS record already exists. Remove or update the existing record first"
+	case errors.Is(err, cloudflare.ErrNotFound), errors.Is(err, dns.ErrZoneNotFound), errors.Is(err, dns.ErrRecordNotFound):
+		return exitNotFound, "The zone or record could not be found. Check the names and that the token has access to the zone"
+	default:
+		return exitError, ""
+	}
+}
+
+// runContext returns a context that is cancelled once --timeout has passed
+func runContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithTimeout(parent, timeout)
+}
+
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+	// the context is cancelled on SIGINT and SIGTERM so that in-flight requests are cancelled on shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if metricsTextfile != "" {
+		metrics.ObserveRun(err)
+		if err := metrics.WriteTextfile(metricsTextfile); err != nil {
+			slog.Error("Failed to write metrics", "path", metricsTextfile, "error", err)
+		}
+	}
+
+	if err != nil {
+		code, hint := exitCodeFor(err)
+		if hint != "" {
+			slog.Error(err.Error(), "hint", hint, "exit_code", code)
+		} else {
+			slog.Error(err.Error(), "exit_code", code)
+		}
+		os.Exit(code)
 	}
 }
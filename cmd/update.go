@@ -1,45 +1,97 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 
+	"github.com/burmudar/cloudflare-dns/config"
 	"github.com/burmudar/cloudflare-dns/dns"
 
 	"github.com/spf13/cobra"
 )
 
 func init() {
-	updateCmd.PersistentFlags().StringVarP(&zoneName, "zone-name", "z", "", "Name of the Zone the DNS record resides in")
+	updateCmd.PersistentFlags().StringSliceVarP(&zoneNames, "zone-name", "z", zoneNames, "Name of one or more Zones the DNS records reside in. When omitted, the zone is resolved from the fully qualified record names")
 	updateCmd.PersistentFlags().IntVarP(&ttlInSeconds, "ttl", "", 3600, "TTL (in seconds) to set on the DNS record")
 	updateCmd.PersistentFlags().StringVarP(&manualIP, "ip", "", "", "Set the content of the dns record to this ip")
 	updateCmd.PersistentFlags().StringSliceVarP(&recordNames, "dns-record-names", "r", recordNames, "Name of one or more DNS records. If more than one record is specified separated them with a comma")
+	updateCmd.PersistentFlags().StringSliceVarP(&recordTypes, "type", "", recordTypes, "Type of the DNS records to update, either A, AAAA or A,AAAA to keep both records in sync")
 
-	updateCmd.MarkPersistentFlagRequired("zone-name")
-	updateCmd.MarkPersistentFlagRequired("dns-record-names")
+	updateCmd.PersistentFlags().BoolVarP(&createMissing, "create-missing", "", true, "Create records that do not exist. When false, missing records are reported as errors")
+	updateCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "Show which records would be created, updated or left unchanged without changing anything")
+	updateCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Config file (YAML or TOML) describing the zones and records to update. Cannot be combined with --zone-name or --dns-record-names")
+
+	updateCmd.MarkFlagsMutuallyExclusive("config", "zone-name")
+	updateCmd.MarkFlagsMutuallyExclusive("config", "dns-record-names")
+	addLookupFlags(updateCmd)
 	rootCmd.AddCommand(updateCmd)
 }
 
 var updateCmd = &cobra.Command{
 	Use:   "update",
-	Short: "Update a type A DNS record found in the given <zoneId> with the public IP",
-	Long:  `Using the zone id the DNS record is retrieved and the content is updated to the latest public ip`,
+	Short: "Update type A and/or AAAA DNS records found in the given zones with the public IP",
+	Long: `Using the zone names the DNS records are retrieved and the content is updated to the latest public ip.
+Records in multiple zones can be updated in one run by passing several zones or fully qualified record names`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext(cmd.Context())
+		defer cancel()
+
 		client, err := createClient()
 		if err != nil {
 			return err
 		}
 
-		for _, name := range recordNames {
-			if _, err := dns.UpdateRecord(client, dns.Record{
-				ZoneName: zoneName,
-				Name:     dns.NormaliseRecordName(zoneName, name),
-				TTL:      ttlInSeconds,
-				IP:       manualIP,
-			}); err != nil {
-				return fmt.Errorf("error updating %s: %w", name, err)
+		records, err := recordsToUpdate(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		var result summary
+		var changes []*dns.Change
+		for _, record := range records {
+			change, err := dns.PlanRecord(ctx, client, record, dns.PlanOptions{CreateMissing: createMissing})
+			if err == nil && dryRun {
+				changes = append(changes, change)
+			} else if err == nil {
+				_, err = dns.ApplyChange(ctx, client, change)
 			}
+			result.Add(changeResult(record, change, err), err)
+		}
+
+		// a dry run shows the plan when the output is for people, scripts get the planned action of every record
+		if dryRun && outputFormat == outputTable {
+			dns.WritePlan(os.Stdout, changes)
+		} else if err := result.Write(os.Stdout, outputFormat); err != nil {
+			return err
 		}
 
-		return nil
+		if dryRun {
+			return result.Err("plan")
+		}
+		return result.Err("update")
 	},
 }
+
+// recordsToUpdate returns the records described by the config file when one is given, otherwise the records
+// are created from the command line flags
+func recordsToUpdate(ctx context.Context, client dns.DNSClient) ([]dns.Record, error) {
+	if configPath != "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return nil, err
+		}
+		return cfg.Records()
+	}
+
+	if len(recordNames) == 0 {
+		return nil, fmt.Errorf("either --config or --dns-record-names is required")
+	}
+
+	types, err := parseAddressTypes(recordTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordsFromFlags(ctx, client, zoneNames, recordNames, types)
+}
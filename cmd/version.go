@@ -1,7 +1,7 @@
 package cmd
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -16,7 +16,20 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "displays version information",
 	Long:  "displays the Build Time and Version of this binary",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Build Time: %s\nVersion: %s\nCommit: %s\n", BuildTime, BuildVersion, BuildCommit)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		info := []versionInfo{{BuildTime: BuildTime, Version: BuildVersion, Commit: BuildCommit}}
+		return writeOutput(os.Stdout, outputFormat, info, versionColumns)
 	},
 }
+
+type versionInfo struct {
+	BuildTime string `json:"build_time" yaml:"build_time"`
+	Version   string `json:"version" yaml:"version"`
+	Commit    string `json:"commit" yaml:"commit"`
+}
+
+var versionColumns = []column[versionInfo]{
+	{"build_time", func(v versionInfo) string { return v.BuildTime }},
+	{"version", func(v versionInfo) string { return v.Version }},
+	{"commit", func(v versionInfo) string { return v.Commit }},
+}
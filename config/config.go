@@ -0,0 +1,365 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/retrievers"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTTL is the TTL used for records when neither the record nor the zone specifies one
+const DefaultTTL = 3600
+
+const (
+	// SourceExternal uses the external ip discovered by the dns client. It is the default when no source is given
+	SourceExternal = "external"
+	// SourceURL retrieves the ip from the body returned by the given url, which is parsed according to Format
+	SourceURL = "url"
+	// SourceConsensus retrieves the ip from multiple urls and only uses it when a quorum of them agree
+	SourceConsensus = "consensus"
+	// SourceInterface uses an address assigned to a local network interface
+	SourceInterface = "interface"
+	// SourceDNS retrieves the ip with a DNS query to a resolver that answers with the address of the client
+	SourceDNS = "dns"
+	// SourceSTUN retrieves the ip with a STUN binding request
+	SourceSTUN = "stun"
+	// SourceGateway asks the router for its WAN address with UPnP or NAT-PMP
+	SourceGateway = "gateway"
+)
+
+// Formats of the response of a url or consensus source
+const (
+	FormatText  = retrievers.FormatText
+	FormatJSON  = retrievers.FormatJSON
+	FormatRegex = retrievers.FormatRegex
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Config describes all the zones and the records in them that should be kept up to date
+//
+// Example in YAML:
+//
+//	zones:
+//	  - name: burmudar.dev
+//	    ttl: 300
+//	    records:
+//	      - name: files
+//	      - name: media
+//	        type: AAAA
+//	        proxied: true
+//	      - name: vpn
+//	        ip: 10.0.0.1
+//	      - name: www
+//	        source:
+//	          type: url
+//	          url: https://api4.ipify.org
+type Config struct {
+	Zones []Zone `yaml:"zones" toml:"zones"`
+}
+
+type Zone struct {
+	Name string `yaml:"name" toml:"name"`
+	// TTL is the default TTL of records in this zone
+	TTL int `yaml:"ttl" toml:"ttl"`
+	// Proxied is the default proxied status of records in this zone
+	Proxied *bool    `yaml:"proxied" toml:"proxied"`
+	Records []Record `yaml:"records" toml:"records"`
+}
+
+type Record struct {
+	// Name of the record. Names that are not fully qualified are expanded with the zone name and '@' refers
+	// to the zone itself
+	Name    string `yaml:"name" toml:"name"`
+	Type    string `yaml:"type" toml:"type"`
+	TTL     int    `yaml:"ttl" toml:"ttl"`
+	Proxied *bool  `yaml:"proxied" toml:"proxied"`
+	// IP sets the content of A and AAAA records. When empty, the ip is retrieved from Source
+	IP     string `yaml:"ip" toml:"ip"`
+	Source Source `yaml:"source" toml:"source"`
+	// Content sets the content of all other record types and is required for them
+	Content string `yaml:"content" toml:"content"`
+}
+
+// Source describes where the ip of a record is retrieved from
+type Source struct {
+	Type string `yaml:"type" toml:"type"`
+	URL  string `yaml:"url" toml:"url"`
+	// Format is how the ip is extracted from the response of a url source, or of every url of a consensus source:
+	// text, json or regex. Defaults to text
+	Format string `yaml:"format" toml:"format"`
+	// Path is the dot separated path to the ip in a json response, e.g. "ip" or "addresses.0.value"
+	Path string `yaml:"path" toml:"path"`
+	// Pattern is the regular expression that matches the ip in a regex response. When it has a capture group, the
+	// group is used as the ip
+	Pattern string `yaml:"pattern" toml:"pattern"`
+	// URLs are the endpoints queried by a consensus source
+	URLs []string `yaml:"urls" toml:"urls"`
+	// Quorum is the number of URLs that have to agree on the ip. Defaults to 2
+	Quorum int `yaml:"quorum" toml:"quorum"`
+	// Interface is the name of the network interface used by an interface source. Url and consensus sources bind
+	// their connections to it, which is only supported on Linux
+	Interface string `yaml:"interface" toml:"interface"`
+	// Address is the local address url and consensus sources connect from
+	Address string `yaml:"address" toml:"address"`
+	// CIDR optionally limits an interface source to addresses within the prefix, e.g. 10.0.0.0/8
+	CIDR string `yaml:"cidr" toml:"cidr"`
+	// Provider is the DNS provider queried by a dns source, either opendns or cloudflare. Defaults to opendns
+	Provider string `yaml:"provider" toml:"provider"`
+	// Resolvers replace the default resolvers of the provider of a dns source
+	Resolvers []string `yaml:"resolvers" toml:"resolvers"`
+	// Servers replace the default servers of a stun source
+	Servers []string `yaml:"servers" toml:"servers"`
+	// Gateway is the address of the router queried with NAT-PMP by a gateway source. Defaults to the default gateway
+	Gateway string `yaml:"gateway" toml:"gateway"`
+}
+
+// Load reads the config file at path. Files ending in .toml are parsed as TOML, all other files are parsed as YAML
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		meta, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config %s: %w", path, err)
+		}
+		// unknown keys are rejected like they are in YAML, so that a typo does not silently fall back to a default
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, k := range undecoded {
+				keys = append(keys, k.String())
+			}
+			return nil, fmt.Errorf("failed to parse TOML config %s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("failed to parse YAML config %s: %w", path, err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Validate checks that every zone has a name and records, and that every record has a name, a supported type and
+// the content that goes with its type
+func (c *Config) Validate() error {
+	if len(c.Zones) == 0 {
+		return fmt.Errorf("%w: no zones defined", ErrInvalidConfig)
+	}
+
+	for i, z := range c.Zones {
+		if strings.TrimSpace(z.Name) == "" {
+			return fmt.Errorf("%w: zone %d has no name", ErrInvalidConfig, i)
+		}
+		if len(z.Records) == 0 {
+			return fmt.Errorf("%w: zone %s has no records", ErrInvalidConfig, z.Name)
+		}
+		for j, r := range z.Records {
+			if strings.TrimSpace(r.Name) == "" {
+				return fmt.Errorf("%w: record %d in zone %s has no name", ErrInvalidConfig, j, z.Name)
+			}
+			t, err := dns.ParseZoneType(r.Type)
+			if err != nil {
+				return fmt.Errorf("%w: record %s in zone %s: %v", ErrInvalidConfig, r.Name, z.Name, err)
+			}
+			if t.IsAddress() && strings.TrimSpace(r.Content) != "" {
+				return fmt.Errorf("%w: %s record %s in zone %s sets content. Use ip for A and AAAA records", ErrInvalidConfig, t, r.Name, z.Name)
+			}
+			if !t.IsAddress() && (strings.TrimSpace(r.IP) != "" || r.Source.Type != "" || r.Source.URL != "" || len(r.Source.URLs) > 0) {
+				return fmt.Errorf("%w: %s record %s in zone %s sets an ip or source. Use content for %s records", ErrInvalidConfig, t, r.Name, z.Name, t)
+			}
+			if !t.IsAddress() && strings.TrimSpace(r.Content) == "" {
+				return fmt.Errorf("%w: %s record %s in zone %s has no content", ErrInvalidConfig, t, r.Name, z.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Records converts all the records in all the zones to dns.Records. Zone defaults are applied to records that
+// do not set a TTL or proxied status
+func (c *Config) Records() ([]dns.Record, error) {
+	var result []dns.Record
+	for _, z := range c.Zones {
+		for _, r := range z.Records {
+			record, err := r.toRecord(z)
+			if err != nil {
+				return nil, fmt.Errorf("record %s in zone %s: %w", r.Name, z.Name, err)
+			}
+			result = append(result, record)
+		}
+	}
+
+	return result, nil
+}
+
+func (r Record) toRecord(zone Zone) (dns.Record, error) {
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = zone.TTL
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	proxied := r.Proxied
+	if proxied == nil {
+		proxied = zone.Proxied
+	}
+
+	name := strings.TrimSpace(r.Name)
+	if name == "@" {
+		name = zone.Name
+	}
+
+	t, err := dns.ParseZoneType(r.Type)
+	if err != nil {
+		return dns.Record{}, err
+	}
+
+	source, err := r.Source.Retriever(t.Family())
+	if err != nil {
+		return dns.Record{}, err
+	}
+	if source != nil {
+		source = retrievers.Instrument(strings.ToLower(strings.TrimSpace(r.Source.Type)), t.Family(), source)
+	}
+
+	return dns.Record{
+		ZoneName: zone.Name,
+		Type:     t,
+		Name:     dns.NormaliseRecordName(zone.Name, name),
+		IP:       strings.TrimSpace(r.IP),
+		Content:  strings.TrimSpace(r.Content),
+		TTL:      ttl,
+		Proxied:  proxied,
+		Source:   source,
+	}, nil
+}
+
+// Retriever creates the retriever for the source, which only accepts ips of the given family. A nil retriever is
+// returned for SourceExternal, so that the external ip of the dns client is used
+func (s Source) Retriever(family retrievers.Family) (retrievers.StringRetriever, error) {
+	switch strings.ToLower(strings.TrimSpace(s.Type)) {
+	case "", SourceExternal:
+		return nil, nil
+	case SourceURL:
+		if s.URL == "" {
+			return nil, fmt.Errorf("%w: source of type url requires a url", ErrInvalidConfig)
+		}
+		parser, err := s.parser()
+		if err != nil {
+			return nil, err
+		}
+		client, err := s.httpClient(family)
+		if err != nil {
+			return nil, err
+		}
+		return retrievers.NewParsedIPRetriever(client, s.URL, parser, family, 30*time.Second), nil
+	case SourceConsensus:
+		quorum := s.Quorum
+		if quorum == 0 {
+			quorum = retrievers.DefaultQuorum
+		}
+		if quorum < 1 || len(s.URLs) < quorum {
+			return nil, fmt.Errorf("%w: source of type consensus requires at least %d urls", ErrInvalidConfig, quorum)
+		}
+		parser, err := s.parser()
+		if err != nil {
+			return nil, err
+		}
+		client, err := s.httpClient(family)
+		if err != nil {
+			return nil, err
+		}
+		return retrievers.NewConsensusParsedURLRetriever(client, s.URLs, parser, family, quorum, 30*time.Second), nil
+	case SourceInterface:
+		if s.Interface == "" {
+			return nil, fmt.Errorf("%w: source of type interface requires an interface", ErrInvalidConfig)
+		}
+		var prefix netip.Prefix
+		if s.CIDR != "" {
+			p, err := netip.ParsePrefix(s.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid cidr '%s': %v", ErrInvalidConfig, s.CIDR, err)
+			}
+			prefix = p.Masked()
+		}
+		return retrievers.NewInterfaceRetriever(s.Interface, family, prefix), nil
+	case SourceDNS:
+		name := strings.ToLower(strings.TrimSpace(s.Provider))
+		if name == "" {
+			name = retrievers.OpenDNS.Name
+		}
+		provider, ok := retrievers.DNSProviders[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown dns provider '%s'", ErrInvalidConfig, s.Provider)
+		}
+		return retrievers.NewDNSRetriever(provider, family, s.Resolvers...), nil
+	case SourceSTUN:
+		return retrievers.NewSTUNRetriever(family, s.Servers...), nil
+	case SourceGateway:
+		if family != retrievers.IPv4 {
+			return nil, fmt.Errorf("%w: source of type gateway only supports A records", ErrInvalidConfig)
+		}
+		return retrievers.NewGatewayRetriever(s.Gateway), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown source type '%s'", ErrInvalidConfig, s.Type)
+	}
+}
+
+// parser creates the parser for the format of a url or consensus source
+func (s Source) parser() (retrievers.ResponseParser, error) {
+	p, err := retrievers.NewResponseParser(s.Format, s.Path, s.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: source with %v", ErrInvalidConfig, err)
+	}
+
+	return p, nil
+}
+
+// httpClient creates the client used by url and consensus sources, which only connects over the family and from
+// the address or interface of the source
+func (s Source) httpClient(family retrievers.Family) (*http.Client, error) {
+	if s.Address == "" && s.Interface == "" {
+		return retrievers.HTTPClientFor(family), nil
+	}
+
+	opts := retrievers.DialOptions{Family: family, Interface: s.Interface}
+	if s.Address != "" {
+		addr, err := netip.ParseAddr(s.Address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid address '%s': %v", ErrInvalidConfig, s.Address, err)
+		}
+		opts.LocalAddr = addr
+	}
+
+	client, err := retrievers.NewHTTPClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	return client, nil
+}
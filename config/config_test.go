@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+)
+
+const yamlConfig = `
+zones:
+  - name: burmudar.dev
+    ttl: 300
+    records:
+      - name: files
+      - name: media
+        type: aaaa
+        ttl: 120
+        proxied: true
+      - name: "@"
+        ip: 10.0.0.1
+      - name: www
+        source:
+          type: url
+          url: https://api4.ipify.org
+      - name: blog
+        type: cname
+        content: burmudar.github.io
+  - name: example.com
+    proxied: false
+    records:
+      - name: vpn.example.com
+`
+
+const tomlConfig = `
+[[zones]]
+name = "burmudar.dev"
+ttl = 300
+
+[[zones.records]]
+name = "files"
+
+[[zones.records]]
+name = "media"
+type = "aaaa"
+ttl = 120
+proxied = true
+
+[[zones.records]]
+name = "@"
+ip = "10.0.0.1"
+
+[[zones.records]]
+name = "www"
+source = { type = "url", url = "https://api4.ipify.org" }
+
+[[zones.records]]
+name = "blog"
+type = "cname"
+content = "burmudar.github.io"
+
+[[zones]]
+name = "example.com"
+proxied = false
+
+[[zones.records]]
+name = "vpn.example.com"
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"YAML config", "config.yaml", yamlConfig},
+		{"TOML config", "config.toml", tomlConfig},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, tc.file, tc.content))
+			if err != nil {
+				t.Fatalf("Unexpected error loading config: %v", err)
+			}
+
+			records, err := cfg.Records()
+			if err != nil {
+				t.Fatalf("Unexpected error converting config to records: %v", err)
+			}
+
+			if len(records) != 6 {
+				t.Fatalf("Got %d records. Wanted 6", len(records))
+			}
+
+			wanted := []struct {
+				zone    string
+				name    string
+				typ     dns.ZoneType
+				ttl     int
+				ip      string
+				content string
+				proxied *bool
+				source  bool
+			}{
+				{"burmudar.dev", "files.burmudar.dev", dns.AType, 300, "", "", nil, false},
+				{"burmudar.dev", "media.burmudar.dev", dns.AAAAType, 120, "", "", boolPtr(true), false},
+				{"burmudar.dev", "burmudar.dev", dns.AType, 300, "10.0.0.1", "", nil, false},
+				{"burmudar.dev", "www.burmudar.dev", dns.AType, 300, "", "", nil, true},
+				{"burmudar.dev", "blog.burmudar.dev", "CNAME", 300, "", "burmudar.github.io", nil, false},
+				{"example.com", "vpn.example.com", dns.AType, DefaultTTL, "", "", boolPtr(false), false},
+			}
+
+			for i, w := range wanted {
+				r := records[i]
+				if r.ZoneName != w.zone || r.Name != w.name || r.Type != w.typ || r.TTL != w.ttl || r.IP != w.ip || r.Content != w.content {
+					t.Errorf("Got %+v. Wanted %+v", r, w)
+				}
+				if (r.Proxied == nil) != (w.proxied == nil) || (r.Proxied != nil && *r.Proxied != *w.proxied) {
+					t.Errorf("Got proxied %v. Wanted %v for %s", r.Proxied, w.proxied, w.name)
+				}
+				if (r.Source != nil) != w.source {
+					t.Errorf("Got source %v. Wanted source %t for %s", r.Source, w.source, w.name)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"No zones", "zones: []"},
+		{"Zone without records", "zones:\n  - name: burmudar.dev"},
+		{"Record without name", "zones:\n  - name: burmudar.dev\n    records:\n      - type: A"},
+		{"Unsupported type", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        type: AAA"},
+		{"Content on A record", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        content: 10.0.0.1"},
+		{"IP on CNAME record", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        type: CNAME\n        ip: 10.0.0.1"},
+		{"CNAME record without content", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        type: CNAME"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "config.yaml", tc.content))
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+			}
+		})
+	}
+
+	t.Run("Unknown keys", func(t *testing.T) {
+		for _, tc := range []struct {
+			file    string
+			content string
+		}{
+			{"config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        ttl_seconds: 300"},
+			{"config.toml", "[[zones]]\nname = \"burmudar.dev\"\n\n[[zones.records]]\nname = \"www\"\nttl_seconds = 300\n"},
+		} {
+			_, err := Load(writeConfig(t, tc.file, tc.content))
+			if err == nil || !strings.Contains(err.Error(), "ttl_seconds") {
+				t.Errorf("Got %v. Wanted an error for the unknown key ttl_seconds in %s", err, tc.file)
+			}
+		}
+	})
+
+	t.Run("Unknown source type", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        source:\n          type: carrier-pigeon"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+
+	t.Run("Interface source with invalid cidr", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: vpn\n        source:\n          type: interface\n          interface: wg0\n          cidr: 10.8.0.0"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+
+	t.Run("DNS source with unknown provider", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        source:\n          type: dns\n          provider: carrier-pigeon"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+
+	t.Run("URL source with json format without path", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        source:\n          type: url\n          url: https://ifconfig.co/json\n          format: json"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+
+	t.Run("Consensus source with json format without path", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        source:\n          type: consensus\n          urls: [https://ifconfig.co/json, https://ipinfo.io/json]\n          format: json"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+
+	t.Run("Consensus source without quorum of urls", func(t *testing.T) {
+		cfg, err := Load(writeConfig(t, "config.yaml", "zones:\n  - name: burmudar.dev\n    records:\n      - name: www\n        source:\n          type: consensus\n          quorum: 2\n          urls: [https://api4.ipify.org]"))
+		if err != nil {
+			t.Fatalf("Unexpected error loading config: %v", err)
+		}
+
+		if _, err := cfg.Records(); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidConfig)
+		}
+	})
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
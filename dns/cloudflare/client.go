@@ -2,21 +2,32 @@ package cloudflare
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/burmudar/cloudflare-dns/dns"
 	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"github.com/burmudar/cloudflare-dns/metrics"
 	"github.com/burmudar/cloudflare-dns/retrievers"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
-	"net/url"
+	neturl "net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const API_CLOUDFLARE_V4 = "https://api.cloudflare.com/client/v4/"
 
+// DefaultPageSize is the number of results requested per page when listing zones and records
+const DefaultPageSize = 100
+
+// maxZonesPageSize is the largest page size the zones endpoint accepts
+const maxZonesPageSize = 50
+
 var ErrFailedToCreateRequest = errors.New("failed to create request")
 
 type HeaderCredentials struct {
@@ -42,28 +53,68 @@ func NewHeaderCredentials(headers ...http.Header) dns.Credentials {
 }
 
 type Client struct {
-	http        *http.Client
-	Credentials dns.Credentials
-	ipRetriever retrievers.StringRetriever
-	api         string
+	http          *http.Client
+	Credentials   dns.Credentials
+	ipRetriever   retrievers.StringRetriever
+	ipv6Retriever retrievers.StringRetriever
+	api           string
+	pageSize      int
+	retry         RetryPolicy
+	sleep         func(ctx context.Context, d time.Duration) error
 }
 
-func NewTokenClient(apiURL, token string) (dns.DNSClient, error) {
+// Option configures optional settings of the Client
+type Option func(c *Client)
+
+// WithIPRetrievers sets the retrievers used to discover the external IPv4 and IPv6 addresses. A nil retriever
+// keeps the default
+func WithIPRetrievers(ipv4, ipv6 retrievers.StringRetriever) Option {
+	return func(c *Client) {
+		if ipv4 != nil {
+			c.ipRetriever = ipv4
+		}
+		if ipv6 != nil {
+			c.ipv6Retriever = ipv6
+		}
+	}
+}
+
+// WithPageSize sets the number of results requested per page when listing zones and records. The zones endpoint
+// accepts at most 50 results per page, so larger sizes are capped for zones
+func WithPageSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.pageSize = size
+		}
+	}
+}
+
+func NewTokenClient(apiURL, token string, opts ...Option) (dns.DNSClient, error) {
 	var headers http.Header = make(http.Header)
 	headers.Add("Authorization", "Bearer "+strings.TrimSpace(token))
 	headers.Add("Content-Type", "application/json")
 
-	url, err := url.Parse(apiURL)
+	url, err := neturl.Parse(apiURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Client{
-		http.DefaultClient,
-		NewHeaderCredentials(headers),
-		retrievers.DefaultIPRetriever,
-		url.String(),
-	}, nil
+	client := &Client{
+		http:          http.DefaultClient,
+		Credentials:   NewHeaderCredentials(headers),
+		ipRetriever:   retrievers.DefaultIPRetriever,
+		ipv6Retriever: retrievers.DefaultIPv6Retriever,
+		api:           url.String(),
+		pageSize:      DefaultPageSize,
+		retry:         DefaultRetryPolicy,
+		sleep:         sleepContext,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client, nil
 }
 
 func (c *Client) urlJoin(p string) string {
@@ -81,12 +132,16 @@ func (c *Client) urlJoin(p string) string {
 	}
 }
 
-func (c *Client) ExternalIP() (string, error) {
-	return c.ipRetriever.Get()
+func (c *Client) ExternalIP(ctx context.Context) (string, error) {
+	return c.ipRetriever.Get(ctx)
 }
 
-func (c *Client) NewRequest(method string, url string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, body)
+func (c *Client) ExternalIPv6(ctx context.Context) (string, error) {
+	return c.ipv6Retriever.Get(ctx)
+}
+
+func (c *Client) NewRequest(ctx context.Context, method string, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 
 	if err != nil {
 		return nil, fmt.Errorf("error creating request. %w", err)
@@ -97,110 +152,207 @@ func (c *Client) NewRequest(method string, url string, body io.Reader) (*http.Re
 	return req, nil
 }
 
-func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to do request. %w", err)
-	}
+// doRequest sends the request and returns the body of the response. Requests that fail with a transient error
+// are retried according to the retry policy of the client. An *APIError is returned when the API responds with a
+// non 2xx status code or reports that the request was not successful
+func (c *Client) doRequest(req *http.Request) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		data, delay, err := c.attemptRequest(req, attempt)
+		if delay < 0 {
+			return data, err
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errorFromResponse(resp)
-	}
+		slog.Warn("Cloudflare API request failed. Retrying", "method", req.Method, "path", req.URL.Path, "attempt", attempt, "delay", delay.Round(time.Millisecond), "error", err)
+		if err := c.sleep(req.Context(), delay); err != nil {
+			return nil, fmt.Errorf("Stopped retrying %s %s. %w", req.Method, req.URL.Path, err)
+		}
 
-	return resp, nil
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to rewind request body for retry. %w", err)
+			}
+			req.Body = body
+		}
+	}
 }
 
-func (c *Client) ListZones() ([]*model.Zone, error) {
-	var url = c.urlJoin("zones")
+// attemptRequest sends the request once. When the request should be retried, the delay before the next attempt
+// is returned, otherwise the delay is negative
+func (c *Client) attemptRequest(req *http.Request, attempt int) ([]byte, time.Duration, error) {
+	const noRetry = time.Duration(-1)
+	canRetry := attempt < c.retry.MaxAttempts
 
-	req, err := c.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.doRequest(req)
+	start := time.Now()
+	resp, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		metrics.ObserveAPIRequest(req.Method, c.endpoint(req.URL), 0, time.Since(start))
+		err = fmt.Errorf("Failed to do request. %w", err)
+		if canRetry && isRetryableError(req.Method, err) {
+			return nil, c.retry.backoff(attempt), err
+		}
+		return nil, noRetry, err
 	}
+	defer resp.Body.Close()
 
 	data, err := ioutil.ReadAll(resp.Body)
+	metrics.ObserveAPIRequest(req.Method, c.endpoint(req.URL), resp.StatusCode, time.Since(start))
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read response body: %v", err)
+		err = fmt.Errorf("error reading response body. %w", err)
+		if canRetry && isIdempotent(req.Method) && isTransientError(err) {
+			return nil, c.retry.backoff(attempt), err
+		}
+		return nil, noRetry, err
 	}
 
-	result := struct {
-		Zones []*model.Zone `json:"result"`
-	}{
-		Zones: []*model.Zone{},
+	if err := errorFromResponse(resp.StatusCode, data); err != nil {
+		if !canRetry || !isRetryableStatus(req.Method, resp.StatusCode) {
+			return nil, noRetry, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		if wait := retryAfter(resp.Header, time.Now()); wait > c.retry.MaxDelay {
+			return nil, noRetry, err
+		} else if wait > delay {
+			delay = wait
+		}
+		return nil, delay, err
 	}
-	err = json.Unmarshal(data, &result)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to unmarshall response to Zones: %v", err)
+
+	return data, noRetry, nil
+}
+
+// endpoint returns the path of the url relative to the API with ids replaced by ':id', so that it can be used as a
+// metric label without creating a label value for every zone and record
+func (c *Client) endpoint(u *neturl.URL) string {
+	path := u.Path
+	if api, err := neturl.Parse(c.api); err == nil {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(api.Path, "/"))
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "zones" || segments[i-1] == "dns_records" {
+			segments[i] = ":id"
+		}
 	}
 
-	return result.Zones, nil
+	return "/" + strings.Join(segments, "/")
 }
 
-func (c *Client) ListRecords(zoneId string) ([]*model.DNSRecord, error) {
-	var url = c.urlJoin(fmt.Sprintf("/zones/%s/dns_records", zoneId))
+// listAll requests every page of the list endpoint at url and returns the results of all the pages. The filter is
+// added to the query of every page request so that results are filtered by the API
+func listAll[T any](ctx context.Context, c *Client, url string, pageSize int, filter neturl.Values) ([]T, error) {
+	var all = []T{}
+	for page := 1; ; page++ {
+		query := neturl.Values{}
+		for k, v := range filter {
+			query[k] = v
+		}
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(pageSize))
 
-	req, err := c.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
+		req, err := c.NewRequest(ctx, "GET", url+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.doRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result model.Response[[]T]
+		err = json.Unmarshal(data, &result)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshall response of page %d: %w", page, err)
+		}
+
+		all = append(all, result.Result...)
+
+		// without result info there is nothing to tell us there are more pages
+		if result.ResultInfo == nil || len(result.Result) == 0 || page >= result.ResultInfo.TotalPages {
+			return all, nil
+		}
 	}
-	resp, err := c.doRequest(req)
-	if err != nil {
-		return nil, err
+}
+
+func (c *Client) ListZones(ctx context.Context) ([]*model.Zone, error) {
+	return c.listZones(ctx, nil)
+}
+
+func (c *Client) ListZonesByName(ctx context.Context, name string) ([]*model.Zone, error) {
+	return c.listZones(ctx, neturl.Values{"name": []string{name}})
+}
+
+func (c *Client) listZones(ctx context.Context, filter neturl.Values) ([]*model.Zone, error) {
+	var url = c.urlJoin("zones")
+
+	pageSize := c.pageSize
+	if pageSize > maxZonesPageSize {
+		pageSize = maxZonesPageSize
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	zones, err := listAll[*model.Zone](ctx, c, url, pageSize, filter)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to read response body: %v", err)
+		return nil, fmt.Errorf("Failed to list Zones: %w", err)
 	}
 
-	result := struct {
-		Records []*model.DNSRecord `json:"result"`
-	}{
-		Records: []*model.DNSRecord{},
-	}
-	err = json.Unmarshal(data, &result)
+	return zones, nil
+}
+
+func (c *Client) ListRecords(ctx context.Context, zoneId string) ([]*model.DNSRecord, error) {
+	return c.listRecords(ctx, zoneId, nil)
+}
+
+func (c *Client) ListRecordsByName(ctx context.Context, zoneId string, name string, recordType dns.ZoneType) ([]*model.DNSRecord, error) {
+	return c.listRecords(ctx, zoneId, neturl.Values{
+		"name": []string{name},
+		"type": []string{string(recordType)},
+	})
+}
+
+func (c *Client) listRecords(ctx context.Context, zoneId string, filter neturl.Values) ([]*model.DNSRecord, error) {
+	var url = c.urlJoin(fmt.Sprintf("/zones/%s/dns_records", zoneId))
+
+	records, err := listAll[*model.DNSRecord](ctx, c, url, c.pageSize, filter)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to unmarshall response to DNSRecords: %v", err)
+		return nil, fmt.Errorf("Failed to list DNSRecords: %w", err)
 	}
 
 	// results returned do not have the zone id, so we add it here
-	for _, r := range result.Records {
+	for _, r := range records {
 		r.ZoneID = zoneId
 	}
 
-	return result.Records, nil
+	return records, nil
 }
 
-func (c *Client) UpdateRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error) {
+func (c *Client) UpdateRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error) {
 	var url = c.urlJoin(fmt.Sprintf("zones/%s/dns_records/%s", r.ZoneID, r.ID))
 	data, err := json.Marshal(r)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.NewRequest("PUT", url, bytes.NewBuffer(data))
+	req, err := c.NewRequest(ctx, "PUT", url, bytes.NewBuffer(data))
 
 	if err != nil {
 		return nil, ErrFailedToCreateRequest
 	}
-	resp, err := c.doRequest(req)
+	data, err = c.doRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body. %w", err)
+	var result model.Response[*model.DNSRecord]
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshall result: %w", err)
 	}
 
-	return nil, err
+	return result.Result, nil
 }
 
-func (c *Client) NewRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error) {
+func (c *Client) NewRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error) {
 	var url = c.urlJoin(fmt.Sprintf("zones/%s/dns_records", r.ZoneID))
 
 	data, err := json.Marshal(r)
@@ -208,74 +360,45 @@ func (c *Client) NewRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error)
 		return nil, err
 	}
 
-	req, err := c.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := c.NewRequest(ctx, "POST", url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to do request: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errorFromResponse(resp)
-	}
-
-	data, err = ioutil.ReadAll(resp.Body)
+	data, err = c.doRequest(req)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body. %w", err)
+		return nil, err
 	}
 
-	var record model.DNSRecord
-
-	if err = json.Unmarshal(data, &record); err != nil {
-		return nil, err
+	var result model.Response[*model.DNSRecord]
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshall result: %w", err)
 	}
 
-	return &record, nil
+	return result.Result, nil
 
 }
 
-func (c *Client) DeleteRecord(r *model.DNSDeleteRequest) (string, error) {
+func (c *Client) DeleteRecord(ctx context.Context, r *model.DNSDeleteRequest) (string, error) {
 	var url = c.urlJoin(fmt.Sprintf("zones/%s/dns_records/%s", r.ZoneID, r.ID))
 
-	req, err := c.NewRequest("DELETE", url, nil)
-
-	resp, err := c.http.Do(req)
+	req, err := c.NewRequest(ctx, "DELETE", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("Failed to do request: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", errorFromResponse(resp)
+		return "", err
 	}
 
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := c.doRequest(req)
 	if err != nil {
-		return "", fmt.Errorf("error reading response body. %w", err)
+		return "", err
 	}
 
-	var result = struct {
-		id string
-	}{}
+	var result model.Response[struct {
+		ID string `json:"id"`
+	}]
 
 	if err := json.Unmarshal(data, &result); err != nil {
 		return "", fmt.Errorf("failed to unmarshall result: %w", err)
 	}
 
-	return result.id, nil
-}
-
-func errorFromResponse(resp *http.Response) error {
-	msg := fmt.Sprintf("Response code <%d>\n", resp.StatusCode)
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		msg = msg + fmt.Sprintf("Body: <error: %s>\n", err)
-	} else {
-		msg = msg + fmt.Sprintf("Body: %s", string(data))
-	}
-
-	return errors.New(msg)
-
+	return result.Result.ID, nil
 }
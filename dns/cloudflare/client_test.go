@@ -0,0 +1,406 @@
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+// pagedHandler serves total records split into pages of the requested per_page size
+func pagedHandler(t *testing.T, total int, requests *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RawQuery)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if page < 1 || perPage < 1 {
+			t.Errorf("Invalid page %d or per_page %d requested", page, perPage)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		records := []*model.DNSRecord{}
+		for i := (page - 1) * perPage; i < page*perPage && i < total; i++ {
+			records = append(records, &model.DNSRecord{ID: fmt.Sprintf("record-%d", i), Name: fmt.Sprintf("r%d.burmudar.dev", i)})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"result":  records,
+			"result_info": model.ResultInfo{
+				Page:       page,
+				PerPage:    perPage,
+				Count:      len(records),
+				TotalCount: total,
+				TotalPages: (total + perPage - 1) / perPage,
+			},
+		})
+	}
+}
+
+func TestListRecordsPagination(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		total    int
+		pageSize int
+		requests int
+	}{
+		{"Single page", 3, 5, 1},
+		{"Exactly full pages", 10, 5, 2},
+		{"Partial last page", 11, 5, 3},
+		{"No records", 0, 5, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []string
+			server := httptest.NewServer(pagedHandler(t, tc.total, &requests))
+			defer server.Close()
+
+			client, err := NewTokenClient(server.URL, "token", WithPageSize(tc.pageSize))
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			records, err := client.ListRecords(context.Background(), "zone-1")
+			if err != nil {
+				t.Fatalf("Unexpected error listing records: %v", err)
+			}
+
+			if len(records) != tc.total {
+				t.Errorf("Got %d records. Wanted %d", len(records), tc.total)
+			}
+			if len(requests) != tc.requests {
+				t.Errorf("Got %d requests. Wanted %d: %v", len(requests), tc.requests, requests)
+			}
+			for i, r := range records {
+				if r.ID != fmt.Sprintf("record-%d", i) {
+					t.Errorf("Got %s. Wanted record-%d. Records out of order", r.ID, i)
+				}
+				if r.ZoneID != "zone-1" {
+					t.Errorf("Got %s. Wanted zone-1. Zone ID not set on record", r.ZoneID)
+				}
+			}
+		})
+	}
+}
+
+func TestListZonesPageSizeCapped(t *testing.T) {
+	var perPage string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perPage = r.URL.Query().Get("per_page")
+		w.Write([]byte(`{"success":true,"result":[{"id":"zone-1","name":"burmudar.dev"}],"result_info":{"page":1,"per_page":50,"total_pages":1}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient(server.URL, "token", WithPageSize(500))
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	zones, err := client.ListZones(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error listing zones: %v", err)
+	}
+
+	if len(zones) != 1 || zones[0].Name != "burmudar.dev" {
+		t.Errorf("Got %v. Wanted the zone burmudar.dev", zones)
+	}
+	if perPage != strconv.Itoa(maxZonesPageSize) {
+		t.Errorf("Got per_page %s. Wanted %d", perPage, maxZonesPageSize)
+	}
+}
+
+func TestListRecordsByNameFilters(t *testing.T) {
+	var query neturl.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"success":true,"result":[{"id":"record-1","name":"files.burmudar.dev","type":"AAAA"}],"result_info":{"page":1,"per_page":100,"total_pages":1}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient(server.URL, "token")
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	records, err := client.ListRecordsByName(context.Background(), "zone-1", "files.burmudar.dev", dns.AAAAType)
+	if err != nil {
+		t.Fatalf("Unexpected error listing records: %v", err)
+	}
+
+	if len(records) != 1 {
+		t.Errorf("Got %d records. Wanted 1", len(records))
+	}
+	if query.Get("name") != "files.burmudar.dev" || query.Get("type") != "AAAA" {
+		t.Errorf("Got query %v. Wanted name and type filters", query)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		wanted error
+	}{
+		{"Invalid token", http.StatusBadRequest, `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}],"messages":[],"result":null}`, ErrUnauthorized},
+		{"Forbidden", http.StatusForbidden, `{"success":false,"errors":[{"code":9999,"message":"Forbidden"}]}`, ErrUnauthorized},
+		{"Unknown zone", http.StatusBadRequest, `{"success":false,"errors":[{"code":7003,"message":"Could not route to /zones/nope/dns_records"}]}`, ErrNotFound},
+		{"Rate limited", http.StatusTooManyRequests, `{"success":false,"errors":[{"code":971,"message":"Please wait and consider throttling your request speed"}]}`, ErrRateLimited},
+		{"Record exists", http.StatusBadRequest, `{"success":false,"errors":[{"code":81057,"message":"The record already exists."}]}`, ErrConflict},
+		{"Unsuccessful with status OK", http.StatusOK, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`, ErrUnauthorized},
+		{"Not a JSON body", http.StatusNotFound, `<html>not found</html>`, ErrNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client, err := NewTokenClient(server.URL, "token", WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+
+			_, err = client.ListZones(context.Background())
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Got %v. Wanted an *APIError", err)
+			}
+			if apiErr.StatusCode != tc.status {
+				t.Errorf("Got status code %d. Wanted %d", apiErr.StatusCode, tc.status)
+			}
+			if !errors.Is(err, tc.wanted) {
+				t.Errorf("Got %v. Wanted error matching %v", err, tc.wanted)
+			}
+			for _, other := range []error{ErrUnauthorized, ErrNotFound, ErrRateLimited, ErrConflict} {
+				if other != tc.wanted && errors.Is(err, other) {
+					t.Errorf("Error %v should not match %v", err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIErrorThroughFindZone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient(server.URL, "token")
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	_, err = dns.FindZone(context.Background(), client, "burmudar.dev")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Got %v. Wanted error matching %v", err, ErrUnauthorized)
+	}
+
+	_, err = dns.ResolveRecordZones(context.Background(), client, []dns.Record{{Name: "files.burmudar.dev"}})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Got %v. Wanted error matching %v", err, ErrUnauthorized)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	const ok = `{"success":true,"result":{"id":"record-1"}}`
+	const unavailable = `{"success":false,"errors":[{"code":10000,"message":"unavailable"}]}`
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		statuses   []int
+		retryAfter string
+		attempts   int
+		success    bool
+		minDelay   time.Duration
+	}{
+		{"GET is retried on 5xx", http.MethodGet, []int{503, 502, 200}, "", 3, true, 0},
+		{"GET gives up after max attempts", http.MethodGet, []int{503, 503, 503, 200}, "", 3, false, 0},
+		{"PUT is retried on 5xx", http.MethodPut, []int{500, 200}, "", 2, true, 0},
+		{"POST is not retried on 5xx", http.MethodPost, []int{503, 200}, "", 1, false, 0},
+		{"POST is retried on 429 honouring Retry-After", http.MethodPost, []int{429, 200}, "2", 2, true, 2 * time.Second},
+		{"Retry-After longer than max delay is not retried", http.MethodGet, []int{429, 200}, "60", 1, false, 0},
+		{"4xx is not retried", http.MethodGet, []int{400, 200}, "", 1, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+
+				status := tc.statuses[attempts]
+				attempts++
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(ok))
+				} else {
+					w.Write([]byte(unavailable))
+				}
+			}))
+			defer server.Close()
+
+			dnsClient, err := NewTokenClient(server.URL, "token", WithRetryPolicy(policy))
+			if err != nil {
+				t.Fatalf("Unexpected error creating client: %v", err)
+			}
+			client := dnsClient.(*Client)
+			var delays []time.Duration
+			client.sleep = func(ctx context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			req, err := client.NewRequest(context.Background(), tc.method, server.URL, bytes.NewBufferString(`{"name":"files"}`))
+			if err != nil {
+				t.Fatalf("Unexpected error creating request: %v", err)
+			}
+			_, err = client.doRequest(req)
+
+			if tc.success && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if !tc.success && err == nil {
+				t.Errorf("Wanted an error after %d attempts", tc.attempts)
+			}
+			if attempts != tc.attempts {
+				t.Errorf("Got %d attempts. Wanted %d", attempts, tc.attempts)
+			}
+			for i, b := range bodies {
+				if b != `{"name":"files"}` {
+					t.Errorf("Got body %q on attempt %d. Request body not rewound", b, i+1)
+				}
+			}
+			for _, d := range delays {
+				if d < tc.minDelay || d > policy.MaxDelay {
+					t.Errorf("Got delay %s. Wanted a delay between %s and %s", d, tc.minDelay, policy.MaxDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	urlErr := func(err error) error {
+		return &neturl.Error{Op: "Get", URL: "https://api.cloudflare.com", Err: err}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		err    error
+		wanted bool
+	}{
+		{"Connection refused", http.MethodPost, urlErr(refused), true},
+		{"Connection reset", http.MethodGet, urlErr(reset), true},
+		{"Connection reset after sending a POST", http.MethodPost, urlErr(reset), false},
+		{"Timeout", http.MethodPut, urlErr(timeout), true},
+		{"Unexpected EOF", http.MethodDelete, urlErr(io.ErrUnexpectedEOF), true},
+		{"Temporary DNS failure", http.MethodPost, urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}}), true},
+		{"Unknown host", http.MethodGet, urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}), false},
+		{"Invalid certificate", http.MethodGet, urlErr(x509.UnknownAuthorityError{}), false},
+		{"Invalid URL", http.MethodGet, urlErr(errors.New("unsupported protocol scheme")), false},
+		{"Context cancelled", http.MethodGet, urlErr(context.Canceled), false},
+	} {
+		if got := isRetryableError(tc.method, tc.err); got != tc.wanted {
+			t.Errorf("Got %t. Wanted %t for %s: %v", got, tc.wanted, tc.name, tc.err)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value  string
+		wanted time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"Mon, 01 May 2023 12:00:30 GMT", 30 * time.Second},
+		{"Mon, 01 May 2023 11:00:00 GMT", 0},
+		{"soon", 0},
+	} {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set("Retry-After", tc.value)
+		}
+
+		if got := retryAfter(header, now); got != tc.wanted {
+			t.Errorf("Got %s. Wanted %s for Retry-After %q", got, tc.wanted, tc.value)
+		}
+	}
+}
+
+func TestRequestCancelledByContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, err := NewTokenClient(server.URL, "token")
+	if err != nil {
+		t.Fatalf("Unexpected error creating client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = client.ListZones(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Got %v. Wanted %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Request took %s. It should not be retried once the context is done", elapsed)
+	}
+}
+
+func TestEndpointLabel(t *testing.T) {
+	client := &Client{api: API_CLOUDFLARE_V4}
+
+	for _, tc := range []struct {
+		url    string
+		wanted string
+	}{
+		{"https://api.cloudflare.com/client/v4/zones?page=1", "/zones"},
+		{"https://api.cloudflare.com/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353/dns_records", "/zones/:id/dns_records"},
+		{"https://api.cloudflare.com/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353/dns_records/372e67954025e0ba6aaa6d586b9e0b59", "/zones/:id/dns_records/:id"},
+	} {
+		u, err := neturl.Parse(tc.url)
+		if err != nil {
+			t.Fatalf("Invalid url %s: %v", tc.url, err)
+		}
+
+		if got := client.endpoint(u); got != tc.wanted {
+			t.Errorf("Got %s. Wanted %s for %s", got, tc.wanted, tc.url)
+		}
+	}
+}
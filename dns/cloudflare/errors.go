@@ -0,0 +1,101 @@
+package cloudflare
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+// Sentinels that an *APIError matches with errors.Is, depending on the status code and error codes in the response
+var (
+	ErrUnauthorized = errors.New("cloudflare: authentication failed")
+	ErrNotFound     = errors.New("cloudflare: not found")
+	ErrRateLimited  = errors.New("cloudflare: rate limited")
+	ErrConflict     = errors.New("cloudflare: conflict")
+)
+
+// Cloudflare error codes that identify the sentinels when the status code is not specific enough
+var (
+	unauthorizedCodes = []int{9103, 9106, 9107, 9109, 10000, 10001}
+	notFoundCodes     = []int{7003, 81044}
+	rateLimitedCodes  = []int{971, 10013}
+	conflictCodes     = []int{81053, 81057, 81058}
+)
+
+// APIError is returned when the API responds with a non 2xx status code or when the response reports that the
+// request was not successful
+type APIError struct {
+	StatusCode int
+	Errors     []model.ResponseInfo
+	Messages   []model.ResponseInfo
+	// Body is the raw response body. It is only set when the body is not a valid API response
+	Body string
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("Response code <%d> Body: %s", e.StatusCode, e.Body)
+	}
+
+	msgs := make([]string, 0, len(e.Errors))
+	for _, info := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s (code %d)", info.Message, info.Code))
+	}
+
+	return fmt.Sprintf("Response code <%d>: %s", e.StatusCode, strings.Join(msgs, ", "))
+}
+
+// Is allows errors.Is to match the error against ErrUnauthorized, ErrNotFound, ErrRateLimited and ErrConflict
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.HasCode(unauthorizedCodes...)
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.HasCode(notFoundCodes...)
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests || e.HasCode(rateLimitedCodes...)
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict || e.HasCode(conflictCodes...)
+	}
+
+	return false
+}
+
+// HasCode returns true when any of the errors in the response has one of the given codes
+func (e *APIError) HasCode(codes ...int) bool {
+	for _, info := range e.Errors {
+		for _, code := range codes {
+			if info.Code == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// errorFromResponse returns an *APIError when the status code is not 2xx or the response is not successful
+func errorFromResponse(statusCode int, data []byte) error {
+	var envelope model.Response[json.RawMessage]
+	parseErr := json.Unmarshal(data, &envelope)
+
+	isOK := statusCode >= 200 && statusCode < 300
+	if isOK && (parseErr != nil || envelope.Success) {
+		return nil
+	}
+
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Errors:     envelope.Errors,
+		Messages:   envelope.Messages,
+	}
+	if parseErr != nil {
+		apiErr.Body = string(data)
+	}
+
+	return apiErr
+}
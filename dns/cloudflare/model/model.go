@@ -9,10 +9,10 @@ import (
 )
 
 type DNSRecordMeta struct {
-	AutoAdd       bool   `json:"auto_added"`
-	ManagedByApps bool   `json:"managed_by_apps"`
-	ManagedByArgo bool   `json:"managed_by_argo_tunnel"`
-	Source        string `json:"Source"`
+	AutoAdd       bool   `json:"auto_added" yaml:"auto_added"`
+	ManagedByApps bool   `json:"managed_by_apps" yaml:"managed_by_apps"`
+	ManagedByArgo bool   `json:"managed_by_argo_tunnel" yaml:"managed_by_argo_tunnel"`
+	Source        string `json:"Source" yaml:"Source"`
 }
 
 func (r *DNSRecordMeta) String() string {
@@ -98,19 +98,20 @@ func (r *DNSRecordRequest) Sanitize() error {
 }
 
 type DNSRecord struct {
-	ID        string         `json:"id"`
-	ZoneID    string         `json:"zone_id"`
-	ZoneName  string         `json:"zone_name"`
-	Name      string         `json:"name"`
-	Type      string         `json:"type"`
-	Content   string         `json:"content"`
-	Proxiable bool           `json:"proxiable"`
-	Proxied   bool           `json:"proxied"`
-	TTL       int            `json:"ttl"`
-	Locked    bool           `json:"locked"`
-	Created   *time.Time     `json:"created_on"`
-	Modified  *time.Time     `json:"modified_on"`
-	Meta      *DNSRecordMeta `json:"meta"`
+	ID        string         `json:"id" yaml:"id"`
+	ZoneID    string         `json:"zone_id" yaml:"zone_id"`
+	ZoneName  string         `json:"zone_name" yaml:"zone_name"`
+	Name      string         `json:"name" yaml:"name"`
+	Type      string         `json:"type" yaml:"type"`
+	Content   string         `json:"content" yaml:"content"`
+	Proxiable bool           `json:"proxiable" yaml:"proxiable"`
+	Proxied   bool           `json:"proxied" yaml:"proxied"`
+	TTL       int            `json:"ttl" yaml:"ttl"`
+	Priority  *int           `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Locked    bool           `json:"locked" yaml:"locked"`
+	Created   *time.Time     `json:"created_on" yaml:"created_on"`
+	Modified  *time.Time     `json:"modified_on" yaml:"modified_on"`
+	Meta      *DNSRecordMeta `json:"meta" yaml:"meta"`
 }
 
 func (r *DNSRecord) String() string {
@@ -126,6 +127,9 @@ func (r *DNSRecord) String() string {
 	fmt.Fprintf(w, "Proxiable\t: %t\n", r.Proxiable)
 	fmt.Fprintf(w, "Proxied\t: %t\n", r.Proxied)
 	fmt.Fprintf(w, "TTL\t: %d\n", r.TTL)
+	if r.Priority != nil {
+		fmt.Fprintf(w, "Priority\t: %d\n", *r.Priority)
+	}
 	fmt.Fprintf(w, "Locked\t: %t\n", r.Locked)
 	fmt.Fprintf(w, "Created\t: %s\n", r.Created)
 	fmt.Fprintf(w, "Modified\t: %s\n", r.Modified)
@@ -174,3 +178,27 @@ func (z *Zone) String() string {
 	w.Flush()
 	return buf.String()
 }
+
+// ResultInfo is the pagination information returned by list endpoints
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+// ResponseInfo is an error or message returned by the API
+type ResponseInfo struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Response is the envelope every API response is wrapped in
+type Response[T any] struct {
+	Success    bool           `json:"success"`
+	Errors     []ResponseInfo `json:"errors"`
+	Messages   []ResponseInfo `json:"messages"`
+	Result     T              `json:"result"`
+	ResultInfo *ResultInfo    `json:"result_info"`
+}
@@ -0,0 +1,151 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how requests that failed with a transient error are retried. Requests are retried on
+// transient network errors, 5xx responses and 429 responses, with a jittered exponential backoff between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. A value of 1 or less disables retries
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, which doubles on every following retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. When the API asks to wait longer than MaxDelay with the
+	// Retry-After header, the request is not retried
+	MaxDelay time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// WithRetryPolicy sets the policy used to retry requests that failed with a transient error
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// backoff returns the delay before the given retry, where the first retry is 1. Half of the delay is random,
+// so that clients that failed at the same time do not retry at the same time
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isIdempotent returns true for methods that can safely be sent more than once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientError returns true for network errors that might not happen again: timeouts, connections that were
+// reset, refused or closed early and temporary DNS failures. Errors like invalid certificates or URLs are permanent
+func isTransientError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isRetryableError returns true when the request failed with a transient network error. Requests with non
+// idempotent methods are only retried when the connection could not be established, since the request was then
+// never sent. Requests that failed because the context is done are never retried
+func isRetryableError(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if !isTransientError(err) {
+		return false
+	}
+	if isIdempotent(method) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isRetryableStatus returns true when the response status code indicates a transient failure. A 429 response
+// means the request was not processed, so it is safe to retry for every method
+func isRetryableStatus(method string, statusCode int) bool {
+	if statusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	return statusCode >= 500 && isIdempotent(method)
+}
+
+// retryAfter parses the Retry-After header, which is either a number of seconds or a HTTP date. Zero is
+// returned when the header is absent or invalid
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// sleepContext waits for the duration d, unless the context is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
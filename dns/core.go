@@ -1,31 +1,54 @@
 package dns
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"github.com/burmudar/cloudflare-dns/retrievers"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 )
 
 var ErrZoneNotFound = errors.New("Zone not found")
 var ErrRecordNotFound = errors.New("Record not found")
+var ErrIPTypeMismatch = errors.New("IP does not match record type")
+var ErrRecordExists = errors.New("Record already exists")
+var ErrContentRequired = errors.New("Content is required")
+var ErrUnsupportedType = errors.New("Unsupported record type")
+
+// DefaultPriority is the priority used for new records when the record does not specify one
+const DefaultPriority = 10
 
 type ZoneType string
 
 const (
-	AType ZoneType = "A"
+	AType    ZoneType = "A"
+	AAAAType ZoneType = "AAAA"
 )
 
-type DNSClient interface {
-	ExternalIP() (string, error)
-	UpdateRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error)
-	NewRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error)
-	DeleteRecord(r *model.DNSDeleteRequest) (string, error)
+// supportedTypes are the record types that can be created and updated with the Cloudflare API
+var supportedTypes = map[ZoneType]bool{
+	AType: true, AAAAType: true, "CAA": true, "CERT": true, "CNAME": true, "DNSKEY": true, "DS": true, "HTTPS": true,
+	"LOC": true, "MX": true, "NAPTR": true, "NS": true, "PTR": true, "SMIMEA": true, "SRV": true, "SSHFP": true,
+	"SVCB": true, "TLSA": true, "TXT": true, "URI": true,
+}
 
-	ListZones() ([]*model.Zone, error)
-	ListRecords(zoneID string) ([]*model.DNSRecord, error)
+type DNSClient interface {
+	ExternalIP(ctx context.Context) (string, error)
+	ExternalIPv6(ctx context.Context) (string, error)
+	UpdateRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error)
+	NewRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error)
+	DeleteRecord(ctx context.Context, r *model.DNSDeleteRequest) (string, error)
+
+	ListZones(ctx context.Context) ([]*model.Zone, error)
+	ListRecords(ctx context.Context, zoneID string) ([]*model.DNSRecord, error)
+
+	// ListZonesByName only lists the zones with the given name
+	ListZonesByName(ctx context.Context, name string) ([]*model.Zone, error)
+	// ListRecordsByName only lists the records in the zone with the given name and type
+	ListRecordsByName(ctx context.Context, zoneID string, name string, recordType ZoneType) ([]*model.DNSRecord, error)
 }
 
 type Credentials interface {
@@ -37,13 +60,64 @@ type Record struct {
 	ZoneName string
 	Type     ZoneType
 	Name     string
-	IP       string
-	TTL      int
+	// IP is the content of A and AAAA records. When empty, the ip is discovered
+	IP string
+	// Content is the content of all other record types, like the target of a CNAME record or the text of a TXT
+	// record. It is required for those types
+	Content string
+	TTL     int
+	// Priority of MX, SRV and URI records. When nil, DefaultPriority is used for new records
+	Priority *int
+	// Proxied sets whether the record is proxied by Cloudflare. When nil, the proxied status of an existing
+	// record is left as is and new records are not proxied
+	Proxied *bool
+	// Source is used to retrieve the IP when IP is empty. When nil, the external ip of the client is used
+	Source retrievers.StringRetriever
+}
+
+// IsAddress returns true for record types that contain an ip address
+func (t ZoneType) IsAddress() bool {
+	return t == AType || t == AAAAType
 }
 
-func filterByName(records []*model.DNSRecord, name string) *model.DNSRecord {
+// ParseZoneType returns the record type named by s, which is case insensitive. An empty type is an A record and
+// types that Cloudflare does not support are an ErrUnsupportedType
+func ParseZoneType(s string) (ZoneType, error) {
+	t := ZoneType(strings.ToUpper(strings.TrimSpace(s)))
+	if t == "" {
+		return AType, nil
+	}
+	if !supportedTypes[t] {
+		return "", fmt.Errorf("%w '%s'", ErrUnsupportedType, s)
+	}
+
+	return t, nil
+}
+
+// Family returns the address family of the ip contained in records of the type. An empty type is an A record
+func (t ZoneType) Family() retrievers.Family {
+	switch t {
+	case AType, "":
+		return retrievers.IPv4
+	case AAAAType:
+		return retrievers.IPv6
+	default:
+		return retrievers.AnyFamily
+	}
+}
+
+// recordType returns the type of the record, defaulting to AType when no type is set
+func (r Record) recordType() ZoneType {
+	t := ZoneType(strings.TrimSpace(string(r.Type)))
+	if t == "" {
+		return AType
+	}
+	return t
+}
+
+func filterByNameAndType(records []*model.DNSRecord, name string, t ZoneType) *model.DNSRecord {
 	for _, r := range records {
-		if r.Name == name {
+		if r.Name == name && ZoneType(r.Type) == t {
 			return r
 		}
 	}
@@ -61,90 +135,109 @@ func filterZoneByName(zones []*model.Zone, name string) *model.Zone {
 	return nil
 }
 
-func UpdateRecord(client DNSClient, record Record) (*model.DNSRecord, error) {
-	defer func() { fmt.Fprintln(os.Stderr, "") }()
-	fmt.Fprintf(os.Stderr, "Locating DNS record: %s ...", record.Name)
-	remoteRecord, err := FindRecord(client, record)
+// UpdateRecord updates the content of the record and creates the record when it does not exist
+func UpdateRecord(ctx context.Context, client DNSClient, record Record) (*model.DNSRecord, error) {
+	change, err := PlanRecord(ctx, client, record, PlanOptions{CreateMissing: true})
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "NOT FOUND")
-		return CreateRecord(client, record)
+		return nil, err
+	}
+
+	return ApplyChange(ctx, client, change)
+}
+
+func CreateRecord(ctx context.Context, client DNSClient, record Record) (*model.DNSRecord, error) {
+	change, err := planCreate(ctx, client, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return ApplyChange(ctx, client, change)
+}
+
+// resolveIP returns the content the record should contain. Records that do not contain an ip use their Content.
+// When an A or AAAA record has no IP set, it is retrieved from the record Source, or when the record has no Source,
+// the external ip of the client is used
+func resolveIP(ctx context.Context, client DNSClient, record Record) (string, error) {
+	if !record.recordType().IsAddress() {
+		if record.Content == "" {
+			return "", fmt.Errorf("%s record %s: %w", record.recordType(), record.Name, ErrContentRequired)
+		}
+		return record.Content, nil
 	}
-	fmt.Fprintln(os.Stderr, "FOUND")
 
 	var ip = record.IP
-	if record.IP == "" {
-		fmt.Fprintln(os.Stderr, "Fetching external ip ...")
-		ip, err = client.ExternalIP()
+	var err error
+	if ip == "" && record.Source != nil {
+		slog.Debug("Retrieving ip from record source", "zone", record.ZoneName, "record", record.Name, "type", record.recordType())
+		ip, err = record.Source.Get(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("error getting external ip: %w", err)
+			return "", fmt.Errorf("error getting ip from record source: %w", err)
+		}
+		if ip, err = parseRetrievedIP(ip); err != nil {
+			return "", fmt.Errorf("record source returned an invalid ip: %w", err)
+		}
+	} else if ip == "" {
+		slog.Debug("Fetching external ip", "zone", record.ZoneName, "record", record.Name, "type", record.recordType())
+		ip, err = ExternalIP(ctx, client, record.recordType())
+		if err != nil {
+			return "", fmt.Errorf("error getting external ip: %w", err)
 		}
 	}
 
-	fmt.Fprintf(os.Stderr, "Using IP: %s\n", ip)
-
-	fmt.Fprintf(os.Stderr, "--- Current DNS Record ---\n%s\n", remoteRecord.String())
-
-	if ip == remoteRecord.Content {
-		fmt.Fprintf(os.Stderr, "DNS Record [%s %s] content already contains: %s", remoteRecord.Type, record.Name, ip)
-		return remoteRecord, nil
+	return validateIP(ip, record.recordType())
+}
 
+// ExternalIP retrieves the external ip of the address family used by the given record type. An error is returned
+// when the client returns anything other than a single ip
+func ExternalIP(ctx context.Context, client DNSClient, t ZoneType) (string, error) {
+	var ip string
+	var err error
+	if t == AAAAType {
+		ip, err = client.ExternalIPv6(ctx)
+	} else {
+		ip, err = client.ExternalIP(ctx)
 	}
-	req := model.DNSRecordRequest{
-		ID:      remoteRecord.ID,
-		ZoneID:  remoteRecord.ZoneID,
-		Name:    remoteRecord.Name,
-		Type:    remoteRecord.Type,
-		Content: ip,
-		Proxied: remoteRecord.Proxied,
-		TTL:     record.TTL,
-	}
-
-	if err := req.Sanitize(); err != nil {
-		return nil, err
+	if err != nil {
+		return "", err
 	}
 
-	fmt.Fprintf(os.Stdout, "--- Updating DNS Record ---\n%s\n", req.String())
-
-	return client.UpdateRecord(&req)
+	return parseRetrievedIP(ip)
 }
 
-func CreateRecord(client DNSClient, record Record) (*model.DNSRecord, error) {
-	zone, err := FindZone(client, record.ZoneName)
+// parseRetrievedIP makes sure that content that was retrieved rather than given by the user is exactly one ip.
+// The family is checked by validateIP, so that a mismatch is reported as ErrIPTypeMismatch
+func parseRetrievedIP(content string) (string, error) {
+	addr, err := retrievers.ParseIP(content, retrievers.AnyFamily)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	var ip = record.IP
-	if record.IP == "" {
-		ip, err = client.ExternalIP()
-		if err != nil {
-			return nil, fmt.Errorf("error getting external ip: %w", err)
-		}
-	}
+	return addr.String(), nil
+}
 
-	req := model.DNSRecordRequest{
-		ZoneID:   zone.ID,
-		Name:     record.Name,
-		Content:  ip,
-		Type:     string(record.Type),
-		Proxied:  false,
-		TTL:      record.TTL,
-		Priority: 10,
+// validateIP makes sure that the content of A and AAAA records is a single ip of the family of the record type and
+// returns it in its canonical form. IPv4-mapped IPv6 addresses are IPv4 addresses. An ip of the other family is
+// reported as ErrIPTypeMismatch. Content for other record types is not validated
+func validateIP(ip string, t ZoneType) (string, error) {
+	if !t.IsAddress() {
+		return ip, nil
 	}
 
-	if err := req.Sanitize(); err != nil {
-		return nil, err
+	addr, err := retrievers.ParseIP(ip, t.Family())
+	if err == nil {
+		return addr.String(), nil
+	}
+	if _, anyErr := retrievers.ParseIP(ip, retrievers.AnyFamily); anyErr == nil {
+		return "", fmt.Errorf("'%s' cannot be used for a %s record: %w", ip, t, ErrIPTypeMismatch)
 	}
 
-	fmt.Fprintf(os.Stderr, "--- Creating DNS Record ---\n%s", req.String())
-
-	return client.NewRecord(&req)
+	return "", fmt.Errorf("invalid content for %s record: %w", t, err)
 }
 
-func FindZone(client DNSClient, zoneName string) (*model.Zone, error) {
-	zones, err := client.ListZones()
+func FindZone(ctx context.Context, client DNSClient, zoneName string) (*model.Zone, error) {
+	zones, err := client.ListZonesByName(ctx, zoneName)
 	if err != nil {
-		return nil, fmt.Errorf("Error while listing zones: %v\n", err)
+		return nil, fmt.Errorf("Error while listing zones: %w", err)
 	}
 
 	zone := filterZoneByName(zones, zoneName)
@@ -155,37 +248,92 @@ func FindZone(client DNSClient, zoneName string) (*model.Zone, error) {
 	return zone, nil
 }
 
-func ListRecords(client DNSClient, zoneID string) ([]*model.DNSRecord, error) {
-	zone, err := FindZone(client, zoneID)
+// ZoneForName returns the zone the fully qualified record name belongs to. When more than one zone matches, the
+// zone with the longest name is returned, so that records in a delegated sub zone resolve to the sub zone
+func ZoneForName(zones []*model.Zone, name string) *model.Zone {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	var match *model.Zone
+	for _, z := range zones {
+		zoneName := strings.TrimSuffix(strings.ToLower(z.Name), ".")
+		if name != zoneName && !strings.HasSuffix(name, "."+zoneName) {
+			continue
+		}
+		if match == nil || len(z.Name) > len(match.Name) {
+			match = z
+		}
+	}
+
+	return match
+}
+
+// ResolveRecordZones sets the ZoneName of all records that do not have one, by finding the zone the record name
+// belongs to. Zones are only listed once for all the records
+func ResolveRecordZones(ctx context.Context, client DNSClient, records []Record) ([]Record, error) {
+	var zones []*model.Zone
+	result := make([]Record, 0, len(records))
+	for _, r := range records {
+		if r.ZoneName != "" {
+			result = append(result, r)
+			continue
+		}
+
+		if zones == nil {
+			var err error
+			zones, err = client.ListZones(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("Error while listing zones: %w", err)
+			}
+		}
+
+		zone := ZoneForName(zones, r.Name)
+		if zone == nil {
+			return nil, fmt.Errorf("no zone found for record %s: %w", r.Name, ErrZoneNotFound)
+		}
+
+		r.ZoneName = zone.Name
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+func ListRecords(ctx context.Context, client DNSClient, zoneID string) ([]*model.DNSRecord, error) {
+	zone, err := FindZone(ctx, client, zoneID)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.ListRecords(zone.ID)
+	return client.ListRecords(ctx, zone.ID)
 }
 
-func FindRecord(client DNSClient, record Record) (*model.DNSRecord, error) {
-	records, err := ListRecords(client, record.ZoneName)
+func FindRecord(ctx context.Context, client DNSClient, record Record) (*model.DNSRecord, error) {
+	zone, err := FindZone(ctx, client, record.ZoneName)
 	if err != nil {
 		return nil, err
 	}
 
-	remoteRecord := filterByName(records, record.Name)
+	records, err := client.ListRecordsByName(ctx, zone.ID, record.Name, record.recordType())
+	if err != nil {
+		return nil, err
+	}
+
+	remoteRecord := filterByNameAndType(records, record.Name, record.recordType())
 	if remoteRecord == nil {
-		return nil, ErrZoneNotFound
+		return nil, ErrRecordNotFound
 	}
 
 	return remoteRecord, nil
 }
 
-func DeleteRecord(client DNSClient, record Record) (*model.DNSRecord, error) {
-	dnsRecord, err := FindRecord(client, record)
+func DeleteRecord(ctx context.Context, client DNSClient, record Record) (*model.DNSRecord, error) {
+	dnsRecord, err := FindRecord(ctx, client, record)
 	if err != nil {
 		return nil, err
 	}
 
 	//Ignoring the ID that gets sent back, since it's essentially dnsRecord.ID
-	_, err = client.DeleteRecord(&model.DNSDeleteRequest{
+	_, err = client.DeleteRecord(ctx, &model.DNSDeleteRequest{
 		ID:     dnsRecord.ID,
 		ZoneID: dnsRecord.ZoneID,
 	})
@@ -197,8 +345,11 @@ func DeleteRecord(client DNSClient, record Record) (*model.DNSRecord, error) {
 }
 
 func NormaliseRecordName(zoneName string, name string) string {
+	if name == "@" {
+		return zoneName
+	}
 
-	if strings.HasSuffix(name, zoneName) {
+	if name == zoneName || strings.HasSuffix(name, "."+zoneName) {
 		return name
 	}
 
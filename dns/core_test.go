@@ -1,9 +1,11 @@
 package dns
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"github.com/burmudar/cloudflare-dns/retrievers"
 	"testing"
 )
 
@@ -11,11 +13,12 @@ var ErrEmptyResponse error = errors.New("Empty Response. Did you forget to add a
 
 type DummyDNSClient struct {
 	IP        string
+	IPv6      string
 	Requests  map[string]interface{}
 	Responses map[string]interface{}
 }
 
-func (c *DummyDNSClient) DeleteRecord(r *model.DNSDeleteRequest) (string, error) {
+func (c *DummyDNSClient) DeleteRecord(ctx context.Context, r *model.DNSDeleteRequest) (string, error) {
 	c.Requests["DeleteRecord"] = r
 
 	response := c.Responses["DeleteRecord"]
@@ -28,7 +31,7 @@ func (c *DummyDNSClient) DeleteRecord(r *model.DNSDeleteRequest) (string, error)
 	return "", fmt.Errorf("Error DeleteRecord: %w", ErrEmptyResponse)
 }
 
-func (c *DummyDNSClient) NewRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error) {
+func (c *DummyDNSClient) NewRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error) {
 	c.Requests["NewRecord"] = r
 
 	response := c.Responses["NewRecord"]
@@ -40,7 +43,7 @@ func (c *DummyDNSClient) NewRecord(r *model.DNSRecordRequest) (*model.DNSRecord,
 	return nil, fmt.Errorf("Error NewRecord: %w", ErrEmptyResponse)
 }
 
-func (c *DummyDNSClient) UpdateRecord(r *model.DNSRecordRequest) (*model.DNSRecord, error) {
+func (c *DummyDNSClient) UpdateRecord(ctx context.Context, r *model.DNSRecordRequest) (*model.DNSRecord, error) {
 	c.Requests["UpdateRecord"] = r
 
 	response := c.Responses["UpdateRecord"]
@@ -52,7 +55,7 @@ func (c *DummyDNSClient) UpdateRecord(r *model.DNSRecordRequest) (*model.DNSReco
 	return nil, fmt.Errorf("Error UpdateRecord: %w", ErrEmptyResponse)
 }
 
-func (c *DummyDNSClient) ListZones() ([]*model.Zone, error) {
+func (c *DummyDNSClient) ListZones(ctx context.Context) ([]*model.Zone, error) {
 	c.Requests["ListZones"] = &model.DNSRecordRequest{}
 
 	response := c.Responses["ListZones"]
@@ -64,7 +67,7 @@ func (c *DummyDNSClient) ListZones() ([]*model.Zone, error) {
 	return nil, fmt.Errorf("Error ListZones: %w", ErrEmptyResponse)
 }
 
-func (c *DummyDNSClient) ListRecords(zoneID string) ([]*model.DNSRecord, error) {
+func (c *DummyDNSClient) ListRecords(ctx context.Context, zoneID string) ([]*model.DNSRecord, error) {
 	c.Requests["ListRecords"] = nil
 
 	response := c.Responses["ListRecords"]
@@ -76,10 +79,52 @@ func (c *DummyDNSClient) ListRecords(zoneID string) ([]*model.DNSRecord, error)
 	return nil, fmt.Errorf("Error ListRecords: %w", ErrEmptyResponse)
 }
 
-func (c *DummyDNSClient) ExternalIP() (string, error) {
+// ListZonesByName filters the ListZones response by name, the same as the API would
+func (c *DummyDNSClient) ListZonesByName(ctx context.Context, name string) ([]*model.Zone, error) {
+	c.Requests["ListZonesByName"] = name
+
+	response := c.Responses["ListZones"]
+	if v, ok := response.([]*model.Zone); ok {
+		result := []*model.Zone{}
+		for _, z := range v {
+			if z.Name == name {
+				result = append(result, z)
+			}
+		}
+		return result, nil
+	} else if v, ok := response.(error); ok {
+		return nil, v
+	}
+	return nil, fmt.Errorf("Error ListZonesByName: %w", ErrEmptyResponse)
+}
+
+// ListRecordsByName filters the ListRecords response by name and type, the same as the API would
+func (c *DummyDNSClient) ListRecordsByName(ctx context.Context, zoneID string, name string, recordType ZoneType) ([]*model.DNSRecord, error) {
+	c.Requests["ListRecordsByName"] = name
+
+	response := c.Responses["ListRecords"]
+	if v, ok := response.([]*model.DNSRecord); ok {
+		result := []*model.DNSRecord{}
+		for _, r := range v {
+			if r.Name == name && ZoneType(r.Type) == recordType {
+				result = append(result, r)
+			}
+		}
+		return result, nil
+	} else if v, ok := response.(error); ok {
+		return nil, v
+	}
+	return nil, fmt.Errorf("Error ListRecordsByName: %w", ErrEmptyResponse)
+}
+
+func (c *DummyDNSClient) ExternalIP(ctx context.Context) (string, error) {
 	return c.IP, nil
 }
 
+func (c *DummyDNSClient) ExternalIPv6(ctx context.Context) (string, error) {
+	return c.IPv6, nil
+}
+
 func NewDummyClient() *DummyDNSClient {
 	return &DummyDNSClient{
 		Requests:  make(map[string]interface{}),
@@ -169,7 +214,7 @@ func TestUpdateRecord(t *testing.T) {
 			},
 		}
 
-		result, err := UpdateRecord(dummy, Record{
+		result, err := UpdateRecord(context.Background(), dummy, Record{
 			ZoneName: "Test Zone",
 			Type:     "A",
 			Name:     "Thingy",
@@ -228,7 +273,7 @@ func TestUpdateRecord(t *testing.T) {
 			},
 		}
 
-		result, err := UpdateRecord(dummy, Record{
+		result, err := UpdateRecord(context.Background(), dummy, Record{
 			ZoneName: "fake-zone-name-222",
 			Type:     "A",
 			Name:     "fake-record-name-222",
@@ -284,7 +329,7 @@ func TestUpdateRecord(t *testing.T) {
 			},
 		}
 
-		result, err := UpdateRecord(dummy, Record{
+		result, err := UpdateRecord(context.Background(), dummy, Record{
 			ZoneName: "fake-zone-name-222",
 			Type:     "",
 			Name:     "fake-record-name-222",
@@ -302,6 +347,205 @@ func TestUpdateRecord(t *testing.T) {
 	})
 }
 
+func TestUpdateRecordAAAA(t *testing.T) {
+	zones := []*model.Zone{
+		{
+			ID:     "fake-zone-id-222",
+			Name:   "fake-zone-name-222",
+			Status: "ACTIVE",
+		},
+	}
+	records := []*model.DNSRecord{
+		{
+			ID:       "fake-record-a",
+			ZoneID:   "fake-zone-id-222",
+			ZoneName: "fake-zone-name-222",
+			Name:     "fake-record-name-222",
+			Type:     "A",
+			Content:  "128.127.1.1",
+		},
+		{
+			ID:       "fake-record-aaaa",
+			ZoneID:   "fake-zone-id-222",
+			ZoneName: "fake-zone-name-222",
+			Name:     "fake-record-name-222",
+			Type:     "AAAA",
+			Content:  "2001:db8::1",
+		},
+	}
+
+	t.Run("AAAA record is updated with the discovered IPv6 address", func(t *testing.T) {
+		wanted := model.DNSRecord{
+			ID:       "fake-record-aaaa",
+			ZoneID:   "fake-zone-id-222",
+			ZoneName: "fake-zone-name-222",
+			Name:     "fake-record-name-222",
+			Type:     "AAAA",
+			Content:  "2001:db8::2",
+			TTL:      200,
+		}
+		var dummy = &DummyDNSClient{
+			IP:       "128.127.1.2",
+			IPv6:     "2001:db8::2",
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":    zones,
+				"ListRecords":  records,
+				"UpdateRecord": &wanted,
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AAAAType,
+			Name:     "fake-record-name-222",
+			TTL:      200,
+		})
+		if err != nil {
+			t.Fatalf("failed during update record: %v", err)
+		}
+
+		req := dummy.Requests["UpdateRecord"].(*model.DNSRecordRequest)
+		if req.ID != wanted.ID {
+			t.Errorf("Got %s. Wanted %s. Wrong record updated", req.ID, wanted.ID)
+		}
+		validateRequest(t, req, &wanted)
+	})
+
+	t.Run("Invalid external ip is never used as content", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			IP:       "<html>Sign in to the network</html>",
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": records,
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AType,
+			Name:     "fake-record-name-222",
+			TTL:      200,
+		})
+		if !errors.Is(err, retrievers.ErrInvalidIP) {
+			t.Errorf("Got %v. Wanted %v", err, retrievers.ErrInvalidIP)
+		}
+		if _, ok := dummy.Requests["UpdateRecord"]; ok {
+			t.Errorf("UpdateRecord should not be called when the external ip is invalid")
+		}
+	})
+
+	t.Run("IPv4 content for AAAA record returns error", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": records,
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AAAAType,
+			Name:     "fake-record-name-222",
+			IP:       "128.127.1.2",
+			TTL:      200,
+		})
+		if !errors.Is(err, ErrIPTypeMismatch) {
+			t.Errorf("Got %v. Wanted %v", err, ErrIPTypeMismatch)
+		}
+		if _, ok := dummy.Requests["UpdateRecord"]; ok {
+			t.Errorf("UpdateRecord should not be called when the ip does not match the record type")
+		}
+	})
+
+	t.Run("IPv6 content for A record returns error", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			IPv6:     "2001:db8::2",
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AType,
+			Name:     "fake-record-name-222",
+			IP:       "2001:db8::2",
+			TTL:      200,
+		})
+		if !errors.Is(err, ErrIPTypeMismatch) {
+			t.Errorf("Got %v. Wanted %v", err, ErrIPTypeMismatch)
+		}
+		if _, ok := dummy.Requests["NewRecord"]; ok {
+			t.Errorf("NewRecord should not be called when the ip does not match the record type")
+		}
+	})
+
+	t.Run("Content that is not an ip returns error", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AType,
+			Name:     "fake-record-name-222",
+			IP:       "garbage",
+			TTL:      200,
+		})
+		if !errors.Is(err, retrievers.ErrInvalidIP) {
+			t.Errorf("Got %v. Wanted %v", err, retrievers.ErrInvalidIP)
+		}
+		if _, ok := dummy.Requests["NewRecord"]; ok {
+			t.Errorf("NewRecord should not be called when the content is not an ip")
+		}
+	})
+
+	t.Run("IPv4-mapped IPv6 content is used as IPv4", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+				"NewRecord":   &model.DNSRecord{},
+			},
+		}
+
+		_, err := UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AType,
+			Name:     "fake-record-name-222",
+			IP:       "::ffff:1.2.3.4",
+			TTL:      200,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if req := dummy.Requests["NewRecord"].(*model.DNSRecordRequest); req.Content != "1.2.3.4" {
+			t.Errorf("Got content %s. Wanted 1.2.3.4", req.Content)
+		}
+
+		_, err = UpdateRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AAAAType,
+			Name:     "fake-record-name-222",
+			IP:       "::ffff:1.2.3.4",
+			TTL:      200,
+		})
+		if !errors.Is(err, ErrIPTypeMismatch) {
+			t.Errorf("Got %v. Wanted %v", err, ErrIPTypeMismatch)
+		}
+	})
+}
+
 func TestCreateRecord(t *testing.T) {
 	var record = Record{
 		ZoneName: "fake-zone-name-222",
@@ -316,7 +560,7 @@ func TestCreateRecord(t *testing.T) {
 			Responses: map[string]interface{}{},
 		}
 
-		result, err := CreateRecord(dummy, record)
+		result, err := CreateRecord(context.Background(), dummy, record)
 
 		if result != nil {
 			t.Errorf("With no matching zone, result should be nil")
@@ -352,7 +596,7 @@ func TestCreateRecord(t *testing.T) {
 			},
 		}
 
-		result, err := CreateRecord(dummy, record)
+		result, err := CreateRecord(context.Background(), dummy, record)
 
 		if err != nil {
 			t.Fatalf("Unexpected error during CreateRecord: %v", err)
@@ -396,7 +640,7 @@ func TestCreateRecord(t *testing.T) {
 			},
 		}
 
-		result, err := CreateRecord(dummy, record)
+		result, err := CreateRecord(context.Background(), dummy, record)
 
 		if err != nil {
 			t.Fatalf("Unexpected error during CreateRecord: %v", err)
@@ -412,7 +656,7 @@ func TestCreateRecord(t *testing.T) {
 			ZoneName: "fake-zone-name-222",
 			Type:     "A",
 			Name:     "fake-record-name-222",
-			IP:       "999.999.999.999",
+			IP:       "198.51.100.99",
 			TTL:      200,
 		}
 		wanted := model.DNSRecord{
@@ -420,7 +664,7 @@ func TestCreateRecord(t *testing.T) {
 			ZoneID:   "fake-zone-id",
 			ZoneName: "fake-zone-name-222",
 			Name:     "fake-record-name-222",
-			Content:  "999.999.999.999",
+			Content:  "198.51.100.99",
 			Type:     "A",
 			TTL:      200,
 		}
@@ -443,7 +687,7 @@ func TestCreateRecord(t *testing.T) {
 		//for this test, this should not be the discovered IP and the IP in the record should be used!
 		dummy.IP = "should not be the IP"
 
-		result, err := CreateRecord(dummy, record)
+		result, err := CreateRecord(context.Background(), dummy, record)
 
 		if err != nil {
 			t.Fatalf("Unexpected error during CreateRecord: %v", err)
@@ -489,7 +733,7 @@ func TestCreateRecord(t *testing.T) {
 
 		dummy.IP = wanted.Content
 
-		result, err := CreateRecord(dummy, record)
+		result, err := CreateRecord(context.Background(), dummy, record)
 
 		if err != nil {
 			t.Fatalf("Unexpected error during CreateRecord: %v", err)
@@ -516,7 +760,7 @@ func TestDeleteRecord(t *testing.T) {
 			Responses: map[string]interface{}{},
 		}
 
-		_, err := DeleteRecord(dummy, record)
+		_, err := DeleteRecord(context.Background(), dummy, record)
 
 		if err == nil {
 			t.Errorf("With no matching zone, err should not be nil")
@@ -550,7 +794,7 @@ func TestDeleteRecord(t *testing.T) {
 			},
 		}
 
-		result, err := DeleteRecord(dummy, record)
+		result, err := DeleteRecord(context.Background(), dummy, record)
 		if err != nil {
 			t.Fatalf("Unexpected error during DeleteRecord: %v", err)
 		}
@@ -583,3 +827,267 @@ func TestDeleteRecord(t *testing.T) {
 
 	})
 }
+
+func TestResolveRecordZones(t *testing.T) {
+	var dummy = &DummyDNSClient{
+		Requests: make(map[string]interface{}),
+		Responses: map[string]interface{}{
+			"ListZones": []*model.Zone{
+				{ID: "zone-1", Name: "burmudar.dev"},
+				{ID: "zone-2", Name: "lab.burmudar.dev"},
+				{ID: "zone-3", Name: "example.com"},
+			},
+		},
+	}
+
+	records, err := ResolveRecordZones(context.Background(), dummy, []Record{
+		{Name: "files.burmudar.dev"},
+		{Name: "nas.lab.burmudar.dev"},
+		{Name: "example.com"},
+		{Name: "www.example.com", ZoneName: "already-set.com"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error during ResolveRecordZones: %v", err)
+	}
+
+	wanted := []string{"burmudar.dev", "lab.burmudar.dev", "example.com", "already-set.com"}
+	for i, w := range wanted {
+		if records[i].ZoneName != w {
+			t.Errorf("Got %s. Wanted %s. Incorrect zone for %s", records[i].ZoneName, w, records[i].Name)
+		}
+	}
+
+	t.Run("Record without matching zone returns error", func(t *testing.T) {
+		_, err := ResolveRecordZones(context.Background(), dummy, []Record{{Name: "notburmudar.dev"}})
+		if !errors.Is(err, ErrZoneNotFound) {
+			t.Errorf("Got %v. Wanted %v", err, ErrZoneNotFound)
+		}
+	})
+}
+
+func TestNormaliseRecordName(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		wanted string
+	}{
+		{"media", "media.example.com"},
+		{"media.example.com", "media.example.com"},
+		{"example.com", "example.com"},
+		{"fooexample.com", "fooexample.com.example.com"},
+	} {
+		if got := NormaliseRecordName("example.com", tc.name); got != tc.wanted {
+			t.Errorf("Got %s. Wanted %s for %s", got, tc.wanted, tc.name)
+		}
+	}
+}
+
+func TestPlanRecord(t *testing.T) {
+	zones := []*model.Zone{
+		{
+			ID:     "fake-zone-id-222",
+			Name:   "fake-zone-name-222",
+			Status: "ACTIVE",
+		},
+	}
+	current := &model.DNSRecord{
+		ID:       "fake-record-222",
+		ZoneID:   "fake-zone-id-222",
+		ZoneName: "fake-zone-name-222",
+		Name:     "fake-record-name-222",
+		Type:     "A",
+		Content:  "128.127.1.1",
+		TTL:      200,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		records []*model.DNSRecord
+		ip      string
+		ttl     int
+		wanted  Action
+	}{
+		{"Missing record is planned for creation", []*model.DNSRecord{}, "128.127.1.1", 200, ActionCreate},
+		{"Record with different content is planned for update", []*model.DNSRecord{current}, "128.127.1.2", 200, ActionUpdate},
+		{"Record with same content is unchanged", []*model.DNSRecord{current}, "128.127.1.1", 200, ActionUnchanged},
+		{"Record with different TTL is planned for update", []*model.DNSRecord{current}, "128.127.1.1", 300, ActionUpdate},
+		{"Record without TTL keeps the TTL", []*model.DNSRecord{current}, "128.127.1.1", 0, ActionUnchanged},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var dummy = &DummyDNSClient{
+				Requests: make(map[string]interface{}),
+				Responses: map[string]interface{}{
+					"ListZones":   zones,
+					"ListRecords": tc.records,
+				},
+			}
+
+			change, err := PlanRecord(context.Background(), dummy, Record{
+				ZoneName: "fake-zone-name-222",
+				Type:     AType,
+				Name:     "fake-record-name-222",
+				IP:       tc.ip,
+				TTL:      tc.ttl,
+			}, PlanOptions{CreateMissing: true})
+			if err != nil {
+				t.Fatalf("Unexpected error during PlanRecord: %v", err)
+			}
+
+			if change.Action != tc.wanted {
+				t.Errorf("Got %s. Wanted %s", change.Action, tc.wanted)
+			}
+
+			for _, method := range []string{"NewRecord", "UpdateRecord", "DeleteRecord"} {
+				if _, ok := dummy.Requests[method]; ok {
+					t.Errorf("%s should not be called while planning", method)
+				}
+			}
+		})
+	}
+
+	t.Run("Update keeps the priority of the record", func(t *testing.T) {
+		priority := 5
+		withPriority := *current
+		withPriority.Priority = &priority
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{&withPriority},
+			},
+		}
+
+		change, err := PlanRecord(context.Background(), dummy, Record{ZoneName: "fake-zone-name-222", Type: AType, Name: "fake-record-name-222", IP: "128.127.1.2"}, PlanOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error during PlanRecord: %v", err)
+		}
+
+		if change.Request.Priority != priority || change.Request.TTL != current.TTL {
+			t.Errorf("Got priority %d and TTL %d. Wanted %d and %d", change.Request.Priority, change.Request.TTL, priority, current.TTL)
+		}
+	})
+
+	t.Run("Missing record returns error when CreateMissing is false", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+			},
+		}
+
+		_, err := PlanRecord(context.Background(), dummy, Record{
+			ZoneName: "fake-zone-name-222",
+			Type:     AType,
+			Name:     "fake-record-name-222",
+			IP:       "128.127.1.1",
+			TTL:      200,
+		}, PlanOptions{CreateMissing: false})
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Got %v. Wanted %v", err, ErrRecordNotFound)
+		}
+	})
+
+	t.Run("Record with different priority is planned for update", func(t *testing.T) {
+		priority := 10
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{current},
+			},
+		}
+
+		change, err := PlanRecord(context.Background(), dummy, Record{ZoneName: "fake-zone-name-222", Type: AType, Name: "fake-record-name-222", IP: "128.127.1.1", Priority: &priority}, PlanOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error during PlanRecord: %v", err)
+		}
+
+		if change.Action != ActionUpdate || change.Request.Priority != priority {
+			t.Errorf("Got %s with priority %d. Wanted %s with priority %d", change.Action, change.Request.Priority, ActionUpdate, priority)
+		}
+	})
+
+	t.Run("CNAME record is created with its content", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+			},
+		}
+
+		change, err := PlanRecord(context.Background(), dummy, Record{ZoneName: "fake-zone-name-222", Type: "CNAME", Name: "fake-record-name-222", Content: "target.example.com"}, PlanOptions{CreateMissing: true})
+		if err != nil {
+			t.Fatalf("Unexpected error during PlanRecord: %v", err)
+		}
+
+		if change.Request.Content != "target.example.com" || change.Request.Type != "CNAME" {
+			t.Errorf("Got %s %s. Wanted CNAME target.example.com", change.Request.Type, change.Request.Content)
+		}
+	})
+
+	t.Run("CNAME record without content returns error", func(t *testing.T) {
+		var dummy = &DummyDNSClient{
+			Requests: make(map[string]interface{}),
+			Responses: map[string]interface{}{
+				"ListZones":   zones,
+				"ListRecords": []*model.DNSRecord{},
+			},
+		}
+
+		_, err := PlanRecord(context.Background(), dummy, Record{ZoneName: "fake-zone-name-222", Type: "CNAME", Name: "fake-record-name-222", IP: "128.127.1.1"}, PlanOptions{CreateMissing: true})
+		if !errors.Is(err, ErrContentRequired) {
+			t.Errorf("Got %v. Wanted %v", err, ErrContentRequired)
+		}
+	})
+}
+
+func TestParseZoneType(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		wanted ZoneType
+		err    error
+	}{
+		{"", AType, nil},
+		{"aaaa", AAAAType, nil},
+		{" cname ", "CNAME", nil},
+		{"AAA", "", ErrUnsupportedType},
+	} {
+		got, err := ParseZoneType(tc.value)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Got error %v. Wanted %v for '%s'", err, tc.err, tc.value)
+		}
+		if got != tc.wanted {
+			t.Errorf("Got %s. Wanted %s for '%s'", got, tc.wanted, tc.value)
+		}
+	}
+}
+
+func TestFindRecordUsesFilteredLookups(t *testing.T) {
+	var dummy = &DummyDNSClient{
+		Requests: make(map[string]interface{}),
+		Responses: map[string]interface{}{
+			"ListZones": []*model.Zone{
+				{ID: "zone-1", Name: "burmudar.dev"},
+			},
+			"ListRecords": []*model.DNSRecord{
+				{ID: "record-1", Name: "files.burmudar.dev", Type: "A", Content: "128.127.1.1"},
+			},
+		},
+	}
+
+	result, err := FindRecord(context.Background(), dummy, Record{ZoneName: "burmudar.dev", Name: "files.burmudar.dev", Type: AType})
+	if err != nil {
+		t.Fatalf("Unexpected error during FindRecord: %v", err)
+	}
+
+	if result.ID != "record-1" {
+		t.Errorf("Got %s. Wanted record-1", result.ID)
+	}
+
+	for _, method := range []string{"ListZones", "ListRecords"} {
+		if _, ok := dummy.Requests[method]; ok {
+			t.Errorf("%s should not be called when looking up a single record", method)
+		}
+	}
+}
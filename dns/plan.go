@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+	"github.com/burmudar/cloudflare-dns/metrics"
+)
+
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionUnchanged Action = "unchanged"
+)
+
+// Change describes what has to happen to the remote DNS record so that it matches Record
+type Change struct {
+	Action Action
+	Record Record
+	// Current is the remote record as it is before the change. It is nil when the record will be created
+	Current *model.DNSRecord
+	// Request is the request that will be sent to apply the change. It is nil when the record is unchanged
+	Request *model.DNSRecordRequest
+}
+
+type PlanOptions struct {
+	// CreateMissing plans records that do not exist yet for creation. When false, a missing record results in
+	// ErrRecordNotFound
+	CreateMissing bool
+}
+
+// PlanRecord determines whether the record has to be created, updated or can be left unchanged. All the
+// lookups and ip discovery are done, but no mutating calls are made to the client
+func PlanRecord(ctx context.Context, client DNSClient, record Record, opts PlanOptions) (*Change, error) {
+	slog.Debug("Locating DNS record", "zone", record.ZoneName, "record", record.Name, "type", record.recordType())
+	remoteRecord, err := FindRecord(ctx, client, record)
+	if errors.Is(err, ErrRecordNotFound) {
+		slog.Info("DNS record not found", "zone", record.ZoneName, "record", record.Name, "type", record.recordType())
+		if !opts.CreateMissing {
+			return nil, fmt.Errorf("%s %s does not exist and creating missing records is disabled: %w", record.recordType(), record.Name, err)
+		}
+		return planCreate(ctx, client, record)
+	} else if err != nil {
+		return nil, err
+	}
+	slog.Debug("Found DNS record", "zone", record.ZoneName, "record", record.Name, "type", remoteRecord.Type, "id", remoteRecord.ID,
+		"content", remoteRecord.Content, "proxied", remoteRecord.Proxied, "ttl", remoteRecord.TTL)
+
+	ip, err := resolveIP(ctx, client, record)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Using ip", "zone", record.ZoneName, "record", record.Name, "type", remoteRecord.Type, "ip", ip)
+
+	var proxied = remoteRecord.Proxied
+	if record.Proxied != nil {
+		proxied = *record.Proxied
+	}
+
+	// a record without a TTL keeps the TTL of the remote record
+	var ttl = remoteRecord.TTL
+	if record.TTL != 0 {
+		ttl = record.TTL
+	}
+
+	// the priority is always sent, so a record without a priority keeps the priority of the remote record instead
+	// of it being reset to 0
+	var priority = 0
+	if remoteRecord.Priority != nil {
+		priority = *remoteRecord.Priority
+	}
+	var samePriority = true
+	if record.Priority != nil {
+		samePriority = remoteRecord.Priority != nil && *record.Priority == priority
+		priority = *record.Priority
+	}
+
+	if ip == remoteRecord.Content && proxied == remoteRecord.Proxied && ttl == remoteRecord.TTL && samePriority {
+		slog.Info("DNS record is unchanged", "zone", record.ZoneName, "record", record.Name, "type", remoteRecord.Type, "content", ip, "action", ActionUnchanged)
+		return &Change{Action: ActionUnchanged, Record: record, Current: remoteRecord}, nil
+	}
+
+	req := model.DNSRecordRequest{
+		ID:       remoteRecord.ID,
+		ZoneID:   remoteRecord.ZoneID,
+		Name:     remoteRecord.Name,
+		Type:     remoteRecord.Type,
+		Content:  ip,
+		Proxied:  proxied,
+		TTL:      ttl,
+		Priority: priority,
+	}
+
+	if err := req.Sanitize(); err != nil {
+		return nil, err
+	}
+
+	return &Change{Action: ActionUpdate, Record: record, Current: remoteRecord, Request: &req}, nil
+}
+
+func planCreate(ctx context.Context, client DNSClient, record Record) (*Change, error) {
+	zone, err := FindZone(ctx, client, record.ZoneName)
+	if err != nil {
+		return nil, err
+	}
+
+	return PlanCreate(ctx, client, zone, record)
+}
+
+// PlanCreate plans creating the record in the zone. The content is resolved, validated and sanitized the same way
+// as for records planned with PlanRecord
+func PlanCreate(ctx context.Context, client DNSClient, zone *model.Zone, record Record) (*Change, error) {
+	ip, err := resolveIP(ctx, client, record)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxied = false
+	if record.Proxied != nil {
+		proxied = *record.Proxied
+	}
+
+	var priority = DefaultPriority
+	if record.Priority != nil {
+		priority = *record.Priority
+	}
+
+	req := model.DNSRecordRequest{
+		ZoneID:   zone.ID,
+		Name:     record.Name,
+		Content:  ip,
+		Type:     string(record.recordType()),
+		Proxied:  proxied,
+		TTL:      record.TTL,
+		Priority: priority,
+	}
+
+	if err := req.Sanitize(); err != nil {
+		return nil, err
+	}
+
+	return &Change{Action: ActionCreate, Record: record, Request: &req}, nil
+}
+
+// ApplyChange sends the request of the change to the client. Nothing is sent for unchanged records and the
+// current remote record is returned. Changes that are applied successfully are counted in the records metric
+func ApplyChange(ctx context.Context, client DNSClient, change *Change) (*model.DNSRecord, error) {
+	var record *model.DNSRecord
+	var err error
+	switch change.Action {
+	case ActionCreate:
+		slog.Info("Creating DNS record", "zone", change.Record.ZoneName, "record", change.Request.Name, "type", change.Request.Type,
+			"content", change.Request.Content, "proxied", change.Request.Proxied, "ttl", change.Request.TTL, "action", change.Action)
+		record, err = client.NewRecord(ctx, change.Request)
+	case ActionUpdate:
+		slog.Info("Updating DNS record", "zone", change.Record.ZoneName, "record", change.Request.Name, "type", change.Request.Type,
+			"old_content", change.Current.Content, "content", change.Request.Content, "proxied", change.Request.Proxied, "ttl", change.Request.TTL, "action", change.Action)
+		record, err = client.UpdateRecord(ctx, change.Request)
+	case ActionUnchanged:
+		record = change.Current
+	default:
+		return nil, fmt.Errorf("unknown action '%s'", change.Action)
+	}
+
+	if err == nil {
+		metrics.ObserveRecord(string(change.Action))
+	}
+
+	return record, err
+}
+
+// String formats the change similar to a terraform plan, where '+' is a record that will be created and '~' is
+// a record that will be updated
+func (c *Change) String() string {
+	buf := bytes.NewBuffer(nil)
+
+	switch c.Action {
+	case ActionCreate:
+		fmt.Fprintf(buf, "  + %s %s will be created\n", c.Request.Type, c.Request.Name)
+		fmt.Fprintf(buf, "      + content = %q\n", c.Request.Content)
+		fmt.Fprintf(buf, "      + proxied = %t\n", c.Request.Proxied)
+		fmt.Fprintf(buf, "      + ttl     = %d\n", c.Request.TTL)
+	case ActionUpdate:
+		fmt.Fprintf(buf, "  ~ %s %s will be updated in-place\n", c.Request.Type, c.Request.Name)
+		writeAttrChange(buf, "content", fmt.Sprintf("%q", c.Current.Content), fmt.Sprintf("%q", c.Request.Content))
+		writeAttrChange(buf, "proxied", fmt.Sprint(c.Current.Proxied), fmt.Sprint(c.Request.Proxied))
+		writeAttrChange(buf, "ttl    ", fmt.Sprint(c.Current.TTL), fmt.Sprint(c.Request.TTL))
+	case ActionUnchanged:
+		fmt.Fprintf(buf, "    %s %s is unchanged\n", c.Current.Type, c.Current.Name)
+		fmt.Fprintf(buf, "        content = %q\n", c.Current.Content)
+	}
+
+	return buf.String()
+}
+
+func writeAttrChange(w io.Writer, name, old, new string) {
+	if old == new {
+		fmt.Fprintf(w, "        %s = %s\n", name, old)
+	} else {
+		fmt.Fprintf(w, "      ~ %s = %s -> %s\n", name, old, new)
+	}
+}
+
+// WritePlan writes every change followed by a summary of how many records will be created, updated and left
+// unchanged
+func WritePlan(w io.Writer, changes []*Change) {
+	counts := make(map[Action]int)
+	for _, c := range changes {
+		fmt.Fprint(w, c.String())
+		counts[c.Action]++
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d unchanged.\n", counts[ActionCreate], counts[ActionUpdate], counts[ActionUnchanged])
+}
@@ -42,7 +42,7 @@
                 mv $out/bin/{cli,${pname}}
               '';
               checkPhase = false;
-              vendorHash = "sha256-JFvC9V0xS8SZSdLsOtpyTrFzXjYAOaPQaJHdcnJzK3s=";
+              vendorHash = "sha256-s9IaV7RZS91MwRgJvC5e+Pg9apa8ieoa3KJFntLAGms=";
             };
           }
         );
@@ -71,6 +71,7 @@
       nixosModules.default = { config, lib, pkgs, ... }:
         let
           cfg = config.services.cloudflare-dns-ip;
+          settingsFormat = pkgs.formats.yaml { };
         in
         {
           options = with lib;{
@@ -92,12 +93,26 @@
                 description = "group cloudflare-dns-ip should run as";
               };
               zone = mkOption {
-                type = types.str;
-                description = "the zone where the dns record is defined in cloudflare eg. 'burmudar.dev'";
+                type = types.nullOr types.str;
+                default = null;
+                description = "the zone where the dns record is defined in cloudflare eg. 'burmudar.dev'. Ignored when settings is set";
               };
               record = mkOption {
-                type = types.str;
-                description = "the dns record to keep updated eg. www";
+                type = types.nullOr types.str;
+                default = null;
+                description = "the dns record to keep updated eg. www. Ignored when settings is set";
+              };
+              settings = mkOption {
+                type = types.nullOr settingsFormat.type;
+                default = null;
+                description = "config describing the zones and records to keep updated. Rendered to a YAML file and passed with --config";
+                example = {
+                  zones = [{
+                    name = "burmudar.dev";
+                    ttl = 300;
+                    records = [{ name = "files"; } { name = "media"; type = "AAAA"; proxied = true; }];
+                  }];
+                };
               };
               ttl = mkOption {
                 type = types.int;
@@ -107,6 +122,10 @@
             };
           };
           config = lib.mkIf cfg.enable {
+            assertions = [{
+              assertion = cfg.settings != null || (cfg.zone != null && cfg.record != null);
+              message = "services.cloudflare-dns-ip requires either settings or both zone and record to be set";
+            }];
             users.users."${cfg.user}" = {
               createHome = false;
               group = "${cfg.group}";
@@ -125,8 +144,11 @@
               zone = cfg.zone;
               record = cfg.record;
               ttl = toString cfg.ttl;
+              configFile = settingsFormat.generate "cloudflare-dns-ip.yaml" cfg.settings;
               in
-                ''
+                if cfg.settings != null then ''
+                  ${pkgs.cloudflare-dns-ip}/bin/cloudflare-dns-ip update -t ${token} --config ${configFile}
+                '' else ''
                   ${pkgs.cloudflare-dns-ip}/bin/cloudflare-dns-ip update -t ${token} -z ${zone} -r ${record} --ttl ${ttl}
                 '';
               # without 'wantedBy' this unit won't be automatically started at boot
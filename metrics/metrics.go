@@ -0,0 +1,166 @@
+// Package metrics contains the Prometheus metrics of the Cloudflare API client, the ip retrievers and record updates.
+// The metrics are served over HTTP by long running processes and written to a node_exporter textfile by oneshot runs
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloudflare_dns"
+
+// Registry contains all the metrics of this package
+var Registry = prometheus.NewRegistry()
+
+// runtimeRegistry contains the Go runtime and process metrics. They are only served over HTTP, since node_exporter
+// already exports metrics with the same names
+var runtimeRegistry = prometheus.NewRegistry()
+
+var (
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Number of requests sent to the Cloudflare API by method, endpoint and response status. The status is 'error' when no response was received",
+	}, []string{"method", "endpoint", "status"})
+
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Duration of requests to the Cloudflare API by method and endpoint",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	RetrieverRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ip_retriever_requests_total",
+		Help:      "Number of times an ip was retrieved by retriever, address family and result",
+	}, []string{"retriever", "family", "result"})
+
+	RetrieverDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ip_retriever_duration_seconds",
+		Help:      "Duration of retrieving an ip by retriever and address family",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"retriever", "family"})
+
+	IPInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ip_info",
+		Help:      "The last ip retrieved by retriever and address family. The value is always 1",
+	}, []string{"retriever", "family", "ip"})
+
+	Records = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_total",
+		Help:      "Number of DNS records by action: create, update or unchanged",
+	}, []string{"action"})
+
+	LastRunTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Unix time the last run finished",
+	})
+
+	LastRunSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_success",
+		Help:      "1 when the last run succeeded, 0 when it failed",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		APIRequests,
+		APIRequestDuration,
+		RetrieverRequests,
+		RetrieverDuration,
+		IPInfo,
+		Records,
+		LastRunTimestamp,
+		LastRunSuccess,
+	)
+	runtimeRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObserveAPIRequest records a request to the Cloudflare API. A status code of 0 means no response was received
+func ObserveAPIRequest(method, endpoint string, statusCode int, duration time.Duration) {
+	status := "error"
+	if statusCode > 0 {
+		status = strconv.Itoa(statusCode)
+	}
+
+	APIRequests.WithLabelValues(method, endpoint, status).Inc()
+	APIRequestDuration.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+}
+
+// ObserveRetrieval records an ip retrieval. On success the ip replaces the previous ip of the retriever and family
+// in IPInfo
+func ObserveRetrieval(retriever, family, ip string, err error, duration time.Duration) {
+	RetrieverDuration.WithLabelValues(retriever, family).Observe(duration.Seconds())
+	if err != nil {
+		RetrieverRequests.WithLabelValues(retriever, family, "failure").Inc()
+		return
+	}
+
+	RetrieverRequests.WithLabelValues(retriever, family, "success").Inc()
+	IPInfo.DeletePartialMatch(prometheus.Labels{"retriever": retriever, "family": family})
+	IPInfo.WithLabelValues(retriever, family, ip).Set(1)
+}
+
+// ObserveRecord records the action taken for a DNS record
+func ObserveRecord(action string) {
+	Records.WithLabelValues(action).Inc()
+}
+
+// ObserveRun records the end of a run
+func ObserveRun(err error) {
+	LastRunTimestamp.SetToCurrentTime()
+	if err != nil {
+		LastRunSuccess.Set(0)
+	} else {
+		LastRunSuccess.Set(1)
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, runtimeRegistry}, promhttp.HandlerOpts{})
+}
+
+// Serve serves the metrics on /metrics with the listener until the context is done. The listener is created by the
+// caller, so that an address that cannot be listened on is reported before serving starts
+func Serve(ctx context.Context, l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// WriteTextfile writes the metrics to path for the node_exporter textfile collector. The file is replaced
+// atomically, so node_exporter never reads a partially written file
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
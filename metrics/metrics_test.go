@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveAPIRequest(t *testing.T) {
+	ObserveAPIRequest("GET", "/zones", 200, time.Millisecond)
+	ObserveAPIRequest("GET", "/zones", 0, time.Millisecond)
+
+	if got := testutil.ToFloat64(APIRequests.WithLabelValues("GET", "/zones", "200")); got != 1 {
+		t.Errorf("Got %v requests with status 200. Wanted 1", got)
+	}
+	if got := testutil.ToFloat64(APIRequests.WithLabelValues("GET", "/zones", "error")); got != 1 {
+		t.Errorf("Got %v requests without a response. Wanted 1", got)
+	}
+}
+
+func TestObserveRetrieval(t *testing.T) {
+	ObserveRetrieval("http", "IPv4", "203.0.113.1", nil, time.Millisecond)
+	ObserveRetrieval("http", "IPv4", "203.0.113.2", nil, time.Millisecond)
+	ObserveRetrieval("http", "IPv4", "", errors.New("timeout"), time.Millisecond)
+
+	if got := testutil.ToFloat64(RetrieverRequests.WithLabelValues("http", "IPv4", "success")); got != 2 {
+		t.Errorf("Got %v successful retrievals. Wanted 2", got)
+	}
+	if got := testutil.ToFloat64(RetrieverRequests.WithLabelValues("http", "IPv4", "failure")); got != 1 {
+		t.Errorf("Got %v failed retrievals. Wanted 1", got)
+	}
+
+	// only the last ip is reported and a failure does not remove it
+	if got := testutil.CollectAndCount(IPInfo); got != 1 {
+		t.Fatalf("Got %d ip series. Wanted 1", got)
+	}
+	if got := testutil.ToFloat64(IPInfo.WithLabelValues("http", "IPv4", "203.0.113.2")); got != 1 {
+		t.Errorf("Got %v for the last ip. Wanted 1", got)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	ObserveRecord("update")
+	ObserveRun(nil)
+
+	path := filepath.Join(t.TempDir(), "cloudflare_dns.prom")
+	if err := WriteTextfile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading %s: %v", path, err)
+	}
+
+	for _, wanted := range []string{`cloudflare_dns_records_total{action="update"} 1`, "cloudflare_dns_last_run_success 1"} {
+		if !strings.Contains(string(data), wanted) {
+			t.Errorf("Textfile does not contain %q:\n%s", wanted, data)
+		}
+	}
+	if strings.Contains(string(data), "go_goroutines") {
+		t.Errorf("Textfile should not contain runtime metrics")
+	}
+}
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error listening: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, listener)
+	}()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error requesting metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "cloudflare_dns_") {
+		t.Errorf("Got status %d. Wanted the metrics", resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("Unexpected error after shutdown: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package retrievers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Source is a retriever with a name, so that it can be reported when it disagrees with other sources
+type Source struct {
+	Name      string
+	Retriever StringRetriever
+}
+
+// Answer is the result a source returned
+type Answer struct {
+	Source string
+	IP     string
+	Err    error
+}
+
+func (a Answer) String() string {
+	if a.Err != nil {
+		return fmt.Sprintf("%s: error: %v", a.Source, a.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", a.Source, a.IP)
+}
+
+// ConsensusError is returned when not enough sources agreed on an ip
+type ConsensusError struct {
+	Quorum  int
+	Answers []Answer
+}
+
+func (e *ConsensusError) Error() string {
+	answers := make([]string, 0, len(e.Answers))
+	for _, a := range e.Answers {
+		answers = append(answers, a.String())
+	}
+
+	return fmt.Sprintf("no ip was returned by at least %d sources. Answers: %s", e.Quorum, strings.Join(answers, ", "))
+}
+
+// ConsensusRetriever queries multiple sources concurrently and returns the ip once Quorum sources agree on it.
+// Sources are queried in order, starting with Quorum sources at once. When a source fails or disagrees, the next
+// source in the list is queried until the quorum is reached or all sources have answered
+type ConsensusRetriever struct {
+	Sources []Source
+	Quorum  int
+}
+
+func NewConsensusRetriever(quorum int, sources ...Source) *ConsensusRetriever {
+	if quorum < 1 {
+		quorum = 1
+	}
+
+	return &ConsensusRetriever{
+		Sources: sources,
+		Quorum:  quorum,
+	}
+}
+
+// NewConsensusURLRetriever creates a ConsensusRetriever where every url is a source that has to return an ip of
+// the given family in plain text. The answer of every url is cached for ttl
+func NewConsensusURLRetriever(client *http.Client, urls []string, family Family, quorum int, ttl time.Duration) *ConsensusRetriever {
+	return NewConsensusParsedURLRetriever(client, urls, TextParser{}, family, quorum, ttl)
+}
+
+// NewConsensusParsedURLRetriever creates a ConsensusRetriever where the ip is extracted from the body returned by
+// every url with parser
+func NewConsensusParsedURLRetriever(client *http.Client, urls []string, parser ResponseParser, family Family, quorum int, ttl time.Duration) *ConsensusRetriever {
+	sources := make([]Source, 0, len(urls))
+	for _, u := range urls {
+		sources = append(sources, Source{Name: u, Retriever: NewParsedIPRetriever(client, u, parser, family, ttl)})
+	}
+
+	return NewConsensusRetriever(quorum, sources...)
+}
+
+func (c *ConsensusRetriever) Get(ctx context.Context) (string, error) {
+	if len(c.Sources) < c.Quorum {
+		return "", fmt.Errorf("a quorum of %d requires at least %d sources, but only %d are configured", c.Quorum, c.Quorum, len(c.Sources))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered so that sources still running after the quorum is reached do not block
+	results := make(chan Answer, len(c.Sources))
+	next, running := 0, 0
+	query := func() {
+		source := c.Sources[next]
+		next++
+		running++
+		go func() {
+			ip, err := source.Retriever.Get(ctx)
+			results <- Answer{Source: source.Name, IP: strings.TrimSpace(ip), Err: err}
+		}()
+	}
+
+	for running < c.Quorum && next < len(c.Sources) {
+		query()
+	}
+
+	var answers []Answer
+	votes := make(map[string]int)
+	mostVotes := 0
+	for running > 0 {
+		answer := <-results
+		running--
+		answers = append(answers, answer)
+
+		if answer.Err == nil {
+			votes[answer.IP]++
+			if votes[answer.IP] >= c.Quorum {
+				reportDisagreements(answer.IP, answers)
+				return answer.IP, nil
+			}
+			if votes[answer.IP] > mostVotes {
+				mostVotes = votes[answer.IP]
+			}
+		}
+
+		// only query more sources when the sources still running can no longer reach the quorum on their own
+		for mostVotes+running < c.Quorum && next < len(c.Sources) {
+			query()
+		}
+	}
+
+	return "", &ConsensusError{Quorum: c.Quorum, Answers: answers}
+}
+
+func reportDisagreements(ip string, answers []Answer) {
+	for _, a := range answers {
+		if a.Err != nil || a.IP != ip {
+			slog.Warn("Source disagreed with consensus ip", "ip", ip, "source", a.Source, "answer", a.IP, "error", a.Err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeRetriever struct {
+	ip    string
+	err   error
+	calls int
+}
+
+func (f *fakeRetriever) Get(ctx context.Context) (string, error) {
+	f.calls++
+	return f.ip, f.err
+}
+
+func TestConsensusRetriever(t *testing.T) {
+	failed := errors.New("connection refused")
+
+	for _, tc := range []struct {
+		name    string
+		quorum  int
+		sources []*fakeRetriever
+		want    string
+		wantErr bool
+		// queried is the number of sources that should have been queried, counted from the start of the list
+		queried int
+	}{
+		{
+			name:    "first sources agree",
+			quorum:  2,
+			sources: []*fakeRetriever{{ip: "1.1.1.1"}, {ip: "1.1.1.1"}, {ip: "1.1.1.1"}},
+			want:    "1.1.1.1",
+			queried: 2,
+		},
+		{
+			name:    "falls back on failure",
+			quorum:  2,
+			sources: []*fakeRetriever{{err: failed}, {ip: "1.1.1.1"}, {ip: "1.1.1.1"}},
+			want:    "1.1.1.1",
+			queried: 3,
+		},
+		{
+			name:    "falls back on disagreement",
+			quorum:  2,
+			sources: []*fakeRetriever{{ip: "6.6.6.6"}, {ip: "1.1.1.1\n"}, {ip: "1.1.1.1"}},
+			want:    "1.1.1.1",
+			queried: 3,
+		},
+		{
+			name:    "no quorum",
+			quorum:  2,
+			sources: []*fakeRetriever{{ip: "6.6.6.6"}, {ip: "1.1.1.1"}, {err: failed}},
+			wantErr: true,
+			queried: 3,
+		},
+		{
+			name:    "not enough sources",
+			quorum:  3,
+			sources: []*fakeRetriever{{ip: "1.1.1.1"}, {ip: "1.1.1.1"}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sources := make([]Source, 0, len(tc.sources))
+			for i, s := range tc.sources {
+				sources = append(sources, Source{Name: string(rune('a' + i)), Retriever: s})
+			}
+
+			ip, err := NewConsensusRetriever(tc.quorum, sources...).Get(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got ip %s", ip)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ip != tc.want {
+				t.Errorf("expected ip %q, got %q", tc.want, ip)
+			}
+
+			for i, s := range tc.sources {
+				if wantCalls := i < tc.queried; (s.calls > 0) != wantCalls {
+					t.Errorf("source %d queried %d times", i, s.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestConsensusErrorListsAnswers(t *testing.T) {
+	r := NewConsensusRetriever(2,
+		Source{Name: "a", Retriever: NewStaticStringRetriever("1.1.1.1")},
+		Source{Name: "b", Retriever: NewStaticStringRetriever("2.2.2.2")},
+	)
+
+	_, err := r.Get(context.Background())
+	var consensusErr *ConsensusError
+	if !errors.As(err, &consensusErr) {
+		t.Fatalf("expected a ConsensusError, got %v", err)
+	}
+	if len(consensusErr.Answers) != 2 {
+		t.Errorf("expected 2 answers, got %v", consensusErr.Answers)
+	}
+}
+
+func TestConsensusParsedURLRetriever(t *testing.T) {
+	var urls []string
+	for i := 0; i < 2; i++ {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"ip":"203.0.113.1","country":"ZA"}`)
+		}))
+		defer server.Close()
+		urls = append(urls, server.URL)
+	}
+
+	parser, err := NewJSONParser("ip")
+	if err != nil {
+		t.Fatalf("Unexpected error creating parser: %v", err)
+	}
+
+	ip, err := NewConsensusParsedURLRetriever(nil, urls, parser, IPv4, 2, time.Minute).Get(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ip != "203.0.113.1" {
+		t.Errorf("Got %s. Wanted 203.0.113.1", ip)
+	}
+}
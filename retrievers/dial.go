@@ -0,0 +1,95 @@
+package retrievers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// DefaultIPv4HTTPClient only connects over IPv4, so that an IPv4 lookup never reports the IPv6 address
+var DefaultIPv4HTTPClient = mustHTTPClient(DialOptions{Family: IPv4})
+
+// DefaultIPv6HTTPClient only connects over IPv6
+var DefaultIPv6HTTPClient = mustHTTPClient(DialOptions{Family: IPv6})
+
+// DialOptions select the network path HTTP lookups take, so that the ip of a specific path is reported on
+// dual-stack and multi-WAN hosts
+type DialOptions struct {
+	// Family forces connections over IPv4 or IPv6
+	Family Family
+	// LocalAddr is the local address connections are made from
+	LocalAddr netip.Addr
+	// Interface is the name of the network interface connections are bound to. Only supported on Linux
+	Interface string
+}
+
+// NewHTTPClient creates a client with DefaultTimeout that connects according to the options. Proxies from the
+// environment are not used when a local address or interface is set, since the proxy would pick the path. With only
+// a family set, the proxy is still used and connected to over that family
+func NewHTTPClient(opts DialOptions) (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   DefaultTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if opts.LocalAddr.IsValid() {
+		addr := opts.LocalAddr.Unmap()
+		if (opts.Family == IPv4 && !addr.Is4()) || (opts.Family == IPv6 && !addr.Is6()) {
+			return nil, fmt.Errorf("local address %s is not an %s address", addr, opts.Family)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: addr.AsSlice()}
+	}
+
+	if opts.Interface != "" {
+		if _, err := net.InterfaceByName(opts.Interface); err != nil {
+			return nil, fmt.Errorf("invalid interface %s: %w", opts.Interface, err)
+		}
+		control, err := bindToInterface(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+		dialer.Control = control
+	}
+
+	network := "tcp"
+	switch opts.Family {
+	case IPv4:
+		network = "tcp4"
+	case IPv6:
+		network = "tcp6"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	if opts.LocalAddr.IsValid() || opts.Interface != "" {
+		transport.Proxy = nil
+	}
+
+	return &http.Client{Timeout: DefaultTimeout, Transport: transport}, nil
+}
+
+// HTTPClientFor returns the default client for lookups of the family
+func HTTPClientFor(family Family) *http.Client {
+	switch family {
+	case IPv4:
+		return DefaultIPv4HTTPClient
+	case IPv6:
+		return DefaultIPv6HTTPClient
+	default:
+		return DefaultHTTPClient
+	}
+}
+
+func mustHTTPClient(opts DialOptions) *http.Client {
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return client
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package retrievers
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToInterface returns a dialer control function that binds sockets to the interface with SO_BINDTODEVICE
+func bindToInterface(name string) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		})
+		if err != nil {
+			return err
+		}
+		if sockErr != nil {
+			return fmt.Errorf("failed to bind to interface %s: %w", name, sockErr)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package retrievers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// bindToInterface is only implemented on Linux. On other platforms the local address of the interface has to be
+// used instead
+func bindToInterface(name string) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, errors.New("binding to an interface is only supported on Linux, use the local address of the interface instead")
+}
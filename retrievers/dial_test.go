@@ -0,0 +1,76 @@
+package retrievers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(host))
+	}))
+	defer server.Close()
+
+	t.Run("IPv4 client reports the local IPv4 address", func(t *testing.T) {
+		client, err := NewHTTPClient(DialOptions{Family: IPv4, LocalAddr: netip.MustParseAddr("127.0.0.1")})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := NewURLRetriever(server.URL, client).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(data) != "127.0.0.1" {
+			t.Errorf("Got %s. Wanted 127.0.0.1", data)
+		}
+	})
+
+	t.Run("IPv6 client does not connect over IPv4", func(t *testing.T) {
+		client, err := NewHTTPClient(DialOptions{Family: IPv6})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := NewURLRetriever(server.URL, client).Get(context.Background()); err == nil {
+			t.Errorf("Expected an error connecting to an IPv4 server over IPv6")
+		}
+	})
+
+	t.Run("Local address of the wrong family", func(t *testing.T) {
+		if _, err := NewHTTPClient(DialOptions{Family: IPv6, LocalAddr: netip.MustParseAddr("127.0.0.1")}); err == nil {
+			t.Errorf("Expected an error for an IPv4 local address with the IPv6 family")
+		}
+	})
+
+	t.Run("Proxy is only bypassed when bound to a local address", func(t *testing.T) {
+		for _, tc := range []struct {
+			opts  DialOptions
+			proxy bool
+		}{
+			{DialOptions{}, true},
+			{DialOptions{Family: IPv4}, true},
+			{DialOptions{Family: IPv6}, true},
+			{DialOptions{Family: IPv4, LocalAddr: netip.MustParseAddr("127.0.0.1")}, false},
+		} {
+			client, err := NewHTTPClient(tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if proxy := client.Transport.(*http.Transport).Proxy != nil; proxy != tc.proxy {
+				t.Errorf("Got proxy %t. Wanted %t for %+v", proxy, tc.proxy, tc.opts)
+			}
+		}
+	})
+
+	t.Run("Unknown interface", func(t *testing.T) {
+		if _, err := NewHTTPClient(DialOptions{Interface: "does-not-exist0"}); err == nil {
+			t.Errorf("Expected an error for an unknown interface")
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package retrievers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var ErrNoDNSAnswer = errors.New("DNS response contains no usable answer")
+
+// DNSProvider describes a query that a resolver answers with the address the query was received from
+type DNSProvider struct {
+	Name string
+	// Query is the name that is looked up
+	Query string
+	// TXT is true when the address is returned in a TXT record of the CHAOS class instead of an A or AAAA record
+	TXT           bool
+	IPv4Resolvers []string
+	IPv6Resolvers []string
+}
+
+// OpenDNS answers A and AAAA queries for myip.opendns.com with the address of the client
+var OpenDNS = DNSProvider{
+	Name:          "opendns",
+	Query:         "myip.opendns.com.",
+	IPv4Resolvers: []string{"208.67.222.222", "208.67.220.220"},
+	IPv6Resolvers: []string{"2620:119:35::35", "2620:119:53::53"},
+}
+
+// CloudflareDNS answers TXT CH queries for whoami.cloudflare with the address of the client
+var CloudflareDNS = DNSProvider{
+	Name:          "cloudflare",
+	Query:         "whoami.cloudflare.",
+	TXT:           true,
+	IPv4Resolvers: []string{"1.1.1.1", "1.0.0.1"},
+	IPv6Resolvers: []string{"2606:4700:4700::1111", "2606:4700:4700::1001"},
+}
+
+// DNSProviders are the known providers by name
+var DNSProviders = map[string]DNSProvider{
+	OpenDNS.Name:       OpenDNS,
+	CloudflareDNS.Name: CloudflareDNS,
+}
+
+// DNSRetriever retrieves the public ip by querying a resolver that answers with the address of the client. The
+// resolvers are queried over UDP in order until one of them answers with an ip of Family
+type DNSRetriever struct {
+	Provider DNSProvider
+	Family   Family
+	// Resolvers are host:port addresses. The port defaults to 53
+	Resolvers []string
+	// Timeout is the maximum duration of a query to a single resolver
+	Timeout time.Duration
+}
+
+// NewDNSRetriever creates a DNSRetriever with DefaultTimeout. When no resolvers are given, the resolvers of the
+// provider for the family are used
+func NewDNSRetriever(provider DNSProvider, family Family, resolvers ...string) *DNSRetriever {
+	if len(resolvers) == 0 {
+		switch family {
+		case IPv4:
+			resolvers = provider.IPv4Resolvers
+		case IPv6:
+			resolvers = provider.IPv6Resolvers
+		default:
+			resolvers = append(append([]string{}, provider.IPv4Resolvers...), provider.IPv6Resolvers...)
+		}
+	}
+
+	return &DNSRetriever{
+		Provider:  provider,
+		Family:    family,
+		Resolvers: resolvers,
+		Timeout:   DefaultTimeout,
+	}
+}
+
+func (r *DNSRetriever) Get(ctx context.Context) (string, error) {
+	if len(r.Resolvers) == 0 {
+		return "", fmt.Errorf("no resolvers configured for %s", r.Provider.Name)
+	}
+
+	var errs []string
+	for _, resolver := range r.Resolvers {
+		ip, err := r.query(ctx, withDefaultPort(resolver, "53"))
+		if err == nil {
+			return ip, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	return "", fmt.Errorf("all %s resolvers failed: %s", r.Provider.Name, strings.Join(errs, ", "))
+}
+
+// query sends a single query to the resolver and returns the ip in the answer
+func (r *DNSRetriever) query(ctx context.Context, resolver string) (string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	id, msg, err := r.buildQuery()
+	if err != nil {
+		return "", err
+	}
+
+	var ip string
+	err = exchangeUDP(ctx, udpNetwork(r.Family), resolver, msg, func(response []byte) (bool, error) {
+		var resp dnsmessage.Message
+		if err := resp.Unpack(response); err != nil || resp.ID != id || !resp.Response {
+			// not a response to our query, keep waiting for the answer until the timeout
+			return false, nil
+		}
+
+		ip, err = r.parseAnswer(resp)
+		return true, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("query to %s failed: %w", resolver, err)
+	}
+
+	return ip, nil
+}
+
+func (r *DNSRetriever) buildQuery() (uint16, []byte, error) {
+	name, err := dnsmessage.NewName(r.Provider.Query)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid query name '%s': %w", r.Provider.Query, err)
+	}
+
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return 0, nil, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	question := dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}
+	switch {
+	case r.Provider.TXT:
+		question.Type, question.Class = dnsmessage.TypeTXT, dnsmessage.ClassCHAOS
+	case r.Family == IPv6:
+		question.Type = dnsmessage.TypeAAAA
+	}
+
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: !r.Provider.TXT},
+		Questions: []dnsmessage.Question{question},
+	}
+	packed, err := msg.Pack()
+
+	return id, packed, err
+}
+
+// parseAnswer returns the first ip of Family found in the answers of the response
+func (r *DNSRetriever) parseAnswer(resp dnsmessage.Message) (string, error) {
+	if resp.RCode != dnsmessage.RCodeSuccess {
+		return "", fmt.Errorf("%w: response code %s", ErrNoDNSAnswer, resp.RCode)
+	}
+	if resp.Truncated {
+		return "", fmt.Errorf("%w: response is truncated", ErrNoDNSAnswer)
+	}
+
+	var lastErr error
+	for _, answer := range resp.Answers {
+		var content string
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			content = net.IP(body.A[:]).String()
+		case *dnsmessage.AAAAResource:
+			content = net.IP(body.AAAA[:]).String()
+		case *dnsmessage.TXTResource:
+			content = strings.Join(body.TXT, "")
+		default:
+			continue
+		}
+
+		addr, err := ParseIP(content, r.Family)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		return addr.String(), nil
+	}
+
+	if lastErr != nil {
+		return "", lastErr
+	}
+
+	return "", ErrNoDNSAnswer
+}
@@ -0,0 +1,149 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeResolver answers every query with the given answer, which is built for the question in the query
+type fakeResolver struct {
+	conn      net.PacketConn
+	questions chan dnsmessage.Question
+}
+
+func newFakeResolver(t *testing.T, answer func(q dnsmessage.Question) []dnsmessage.Resource) *fakeResolver {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	r := &fakeResolver{conn: conn, questions: make(chan dnsmessage.Question, 10)}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			r.questions <- q
+
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+				Answers:   answer(q),
+			}
+			packed, err := resp.Pack()
+			if err != nil {
+				t.Errorf("failed to pack response: %v", err)
+				return
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+
+	return r
+}
+
+func (r *fakeResolver) Addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+func header(q dnsmessage.Question) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 0}
+}
+
+func TestDNSRetriever(t *testing.T) {
+	t.Run("OpenDNS A query", func(t *testing.T) {
+		resolver := newFakeResolver(t, func(q dnsmessage.Question) []dnsmessage.Resource {
+			return []dnsmessage.Resource{{Header: header(q), Body: &dnsmessage.AResource{A: [4]byte{203, 0, 113, 7}}}}
+		})
+
+		ip, err := NewDNSRetriever(OpenDNS, IPv4, resolver.Addr()).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.7" {
+			t.Errorf("Got %s. Wanted 203.0.113.7", ip)
+		}
+
+		q := <-resolver.questions
+		if q.Name.String() != "myip.opendns.com." || q.Type != dnsmessage.TypeA || q.Class != dnsmessage.ClassINET {
+			t.Errorf("Got question %v. Wanted an A IN query for myip.opendns.com.", q)
+		}
+	})
+
+	t.Run("Cloudflare TXT CH query", func(t *testing.T) {
+		resolver := newFakeResolver(t, func(q dnsmessage.Question) []dnsmessage.Resource {
+			return []dnsmessage.Resource{{Header: header(q), Body: &dnsmessage.TXTResource{TXT: []string{"2001:db8::7"}}}}
+		})
+
+		retriever := NewDNSRetriever(CloudflareDNS, IPv6, resolver.Addr())
+		// the stand-in only listens on IPv4
+		retriever.Family = AnyFamily
+		ip, err := retriever.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "2001:db8::7" {
+			t.Errorf("Got %s. Wanted 2001:db8::7", ip)
+		}
+
+		q := <-resolver.questions
+		if q.Name.String() != "whoami.cloudflare." || q.Type != dnsmessage.TypeTXT || q.Class != dnsmessage.ClassCHAOS {
+			t.Errorf("Got question %v. Wanted a TXT CH query for whoami.cloudflare.", q)
+		}
+	})
+
+	t.Run("Falls back to the next resolver", func(t *testing.T) {
+		empty := newFakeResolver(t, func(q dnsmessage.Question) []dnsmessage.Resource {
+			return nil
+		})
+		resolver := newFakeResolver(t, func(q dnsmessage.Question) []dnsmessage.Resource {
+			return []dnsmessage.Resource{{Header: header(q), Body: &dnsmessage.AResource{A: [4]byte{203, 0, 113, 8}}}}
+		})
+
+		ip, err := NewDNSRetriever(OpenDNS, IPv4, empty.Addr(), resolver.Addr()).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.8" {
+			t.Errorf("Got %s. Wanted 203.0.113.8", ip)
+		}
+	})
+
+	t.Run("Answer of the wrong family is an error", func(t *testing.T) {
+		retriever := NewDNSRetriever(CloudflareDNS, IPv6)
+		_, err := retriever.parseAnswer(dnsmessage.Message{
+			Answers: []dnsmessage.Resource{{Body: &dnsmessage.TXTResource{TXT: []string{"203.0.113.7"}}}},
+		})
+		if !errors.Is(err, ErrInvalidIP) {
+			t.Errorf("Got %v. Wanted %v", err, ErrInvalidIP)
+		}
+	})
+
+	t.Run("Unresponsive resolver times out", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer conn.Close()
+
+		retriever := NewDNSRetriever(OpenDNS, IPv4, conn.LocalAddr().String())
+		retriever.Timeout = 50 * time.Millisecond
+		if _, err := retriever.Get(context.Background()); err == nil {
+			t.Errorf("Expected an error for a resolver that does not answer")
+		}
+	})
+}
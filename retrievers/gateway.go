@@ -0,0 +1,311 @@
+package retrievers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// DefaultSSDPAddr is the multicast address UPnP devices listen on for discovery requests
+const DefaultSSDPAddr = "239.255.255.250:1900"
+
+// DefaultDiscoveryTimeout is how long to wait for gateways to answer a discovery request
+const DefaultDiscoveryTimeout = 2 * time.Second
+
+var (
+	ErrNoGateway = errors.New("No internet gateway found")
+	// ErrCGNAT is returned when the router reports a WAN address in 100.64.0.0/10. The router is then behind the
+	// carrier-grade NAT of the ISP and does not know the public ip
+	ErrCGNAT = errors.New("Router is behind carrier-grade NAT")
+	// ErrPrivateWANAddress is returned when the router reports a private WAN address, which happens when it is
+	// behind another router
+	ErrPrivateWANAddress = errors.New("Router has a private WAN address")
+)
+
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// Search targets of internet gateway devices
+var igdSearchTargets = []string{
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+}
+
+// Services of an internet gateway device that provide GetExternalIPAddress
+var wanServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:",
+	"urn:schemas-upnp-org:service:WANPPPConnection:",
+}
+
+// GatewayRetriever asks the router on the local network for its WAN address. The router is discovered with SSDP
+// and queried with GetExternalIPAddress of its UPnP WANIPConnection service. Routers that do not support UPnP are
+// queried with NAT-PMP, which PCP routers also answer. Only IPv4 addresses are retrieved
+type GatewayRetriever struct {
+	// SSDPAddr is the address discovery requests are sent to
+	SSDPAddr string
+	// Gateway is the address NAT-PMP requests are sent to. The port defaults to 5351 and the default gateway of the
+	// host is used when it is empty
+	Gateway          string
+	DiscoveryTimeout time.Duration
+	// Timeout is the maximum duration of a single UPnP or NAT-PMP request
+	Timeout time.Duration
+
+	client *http.Client
+}
+
+func NewGatewayRetriever(gateway string) *GatewayRetriever {
+	return &GatewayRetriever{
+		SSDPAddr:         DefaultSSDPAddr,
+		Gateway:          gateway,
+		DiscoveryTimeout: DefaultDiscoveryTimeout,
+		Timeout:          DefaultTimeout,
+		client:           DefaultHTTPClient,
+	}
+}
+
+func (r *GatewayRetriever) Get(ctx context.Context) (string, error) {
+	addr, upnpErr := r.upnpExternalIP(ctx)
+	if upnpErr != nil {
+		if ctx.Err() != nil {
+			return "", upnpErr
+		}
+
+		var natpmpErr error
+		addr, natpmpErr = r.natpmpExternalIP(ctx)
+		if natpmpErr != nil {
+			return "", fmt.Errorf("%w. UPnP: %v. NAT-PMP: %v", ErrNoGateway, upnpErr, natpmpErr)
+		}
+	}
+
+	if err := checkWANAddress(addr); err != nil {
+		return "", err
+	}
+
+	return addr.String(), nil
+}
+
+// checkWANAddress returns an error when the address reported by the router is not a public address
+func checkWANAddress(addr netip.Addr) error {
+	switch {
+	case cgnatPrefix.Contains(addr):
+		return fmt.Errorf("%w: the router reports WAN address %s, so the public ip is not known to the router", ErrCGNAT, addr)
+	case addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified():
+		return fmt.Errorf("%w: the router reports WAN address %s, so it is behind another router", ErrPrivateWANAddress, addr)
+	}
+
+	return nil
+}
+
+// upnpExternalIP discovers an internet gateway device and calls GetExternalIPAddress on its WAN connection service
+func (r *GatewayRetriever) upnpExternalIP(ctx context.Context) (netip.Addr, error) {
+	location, err := r.discover(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	serviceType, controlURL, err := r.wanService(ctx, location)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return r.getExternalIPAddress(ctx, serviceType, controlURL)
+}
+
+// discover sends an SSDP search for internet gateway devices and returns the location of the description of the
+// first device that answers
+func (r *GatewayRetriever) discover(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.DiscoveryTimeout)
+	defer cancel()
+
+	dst, err := net.ResolveUDPAddr("udp4", r.SSDPAddr)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	for _, st := range igdSearchTargets {
+		search := fmt.Sprintf("M-SEARCH * HTTP/1.1\r\nHOST: %s\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: %s\r\n\r\n", r.SSDPAddr, st)
+		if _, err := conn.WriteTo([]byte(search), dst); err != nil {
+			return "", fmt.Errorf("failed to send SSDP search: %w", err)
+		}
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("no gateway answered the SSDP search: %w", ctxErr(ctx, err))
+		}
+
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if location := resp.Header.Get("Location"); resp.StatusCode == http.StatusOK && location != "" {
+			return location, nil
+		}
+	}
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	DeviceType string        `xml:"deviceType"`
+	Services   []upnpService `xml:"serviceList>service"`
+	Devices    []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// findService searches the device and its embedded devices for a WAN connection service
+func (d upnpDevice) findService() (upnpService, bool) {
+	for _, s := range d.Services {
+		for _, t := range wanServiceTypes {
+			if strings.HasPrefix(s.ServiceType, t) {
+				return s, true
+			}
+		}
+	}
+
+	for _, child := range d.Devices {
+		if s, ok := child.findService(); ok {
+			return s, true
+		}
+	}
+
+	return upnpService{}, false
+}
+
+// wanService fetches the device description at location and returns the type and control url of the WAN connection
+// service
+func (r *GatewayRetriever) wanService(ctx context.Context, location string) (string, string, error) {
+	data, err := r.do(ctx, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	var desc upnpDescription
+	if err := xml.Unmarshal(data, &desc); err != nil {
+		return "", "", fmt.Errorf("invalid device description at %s: %w", location, err)
+	}
+
+	service, ok := desc.Device.findService()
+	if !ok {
+		return "", "", fmt.Errorf("device at %s has no WANIPConnection or WANPPPConnection service", location)
+	}
+
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	baseURL, err := neturl.Parse(base)
+	if err != nil {
+		return "", "", err
+	}
+	controlURL, err := baseURL.Parse(service.ControlURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return service.ServiceType, controlURL.String(), nil
+}
+
+type soapExternalIPResponse struct {
+	Body struct {
+		Response struct {
+			IP string `xml:"NewExternalIPAddress"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// getExternalIPAddress calls the GetExternalIPAddress action of the service
+func (r *GatewayRetriever) getExternalIPAddress(ctx context.Context, serviceType, controlURL string) (netip.Addr, error) {
+	body := fmt.Sprintf(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetExternalIPAddress xmlns:u="%s"></u:GetExternalIPAddress></s:Body>
+</s:Envelope>`, serviceType)
+
+	headers := http.Header{}
+	headers.Set("Content-Type", `text/xml; charset="utf-8"`)
+	headers.Set("SOAPAction", fmt.Sprintf(`"%s#GetExternalIPAddress"`, serviceType))
+
+	data, err := r.do(ctx, http.MethodPost, controlURL, headers, strings.NewReader(body))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	var resp soapExternalIPResponse
+	if err := xml.Unmarshal(data, &resp); err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid GetExternalIPAddress response: %w", err)
+	}
+
+	addr, err := ParseIP(resp.Body.Response.IP, IPv4)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("GetExternalIPAddress returned an invalid address, the WAN connection might be down: %w", err)
+	}
+
+	return addr, nil
+}
+
+// do sends a request to the gateway and returns the response body
+func (r *GatewayRetriever) do(ctx context.Context, method, url string, headers http.Header, body io.Reader) ([]byte, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to '%s' failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from '%s': %w", url, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(data) > maxBodyInError {
+			data = data[:maxBodyInError]
+		}
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	return data, nil
+}
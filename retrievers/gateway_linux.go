@@ -0,0 +1,60 @@
+//go:build linux
+
+package retrievers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rtfGateway is set for routes that use a gateway, see include/uapi/linux/route.h
+const rtfGateway = 0x2
+
+// defaultGateway returns the gateway of the IPv4 default route from /proc/net/route
+func defaultGateway() (netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer f.Close()
+
+	return parseDefaultGateway(f)
+}
+
+// parseDefaultGateway parses lines in the format of /proc/net/route, where the destination and gateway are
+// addresses in little endian hex
+func parseDefaultGateway(r io.Reader) (netip.Addr, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "00000000" {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfGateway == 0 {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+
+		var ip [4]byte
+		binary.BigEndian.PutUint32(ip[:], binary.LittleEndian.Uint32(raw))
+		return netip.AddrFrom4(ip), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return netip.Addr{}, err
+	}
+
+	return netip.Addr{}, errors.New("no default route")
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package retrievers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDefaultGateway(t *testing.T) {
+	content := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	000200C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	010200C0	0003	0	0	0	00000000	0	0	0
+`
+
+	addr, err := parseDefaultGateway(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if addr.String() != "192.0.2.1" {
+		t.Errorf("Got %s. Wanted 192.0.2.1", addr)
+	}
+}
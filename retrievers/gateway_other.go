@@ -0,0 +1,13 @@
+//go:build !linux
+
+package retrievers
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// defaultGateway is only implemented on Linux. On other platforms the gateway has to be configured
+func defaultGateway() (netip.Addr, error) {
+	return netip.Addr{}, errors.New("the default gateway can only be detected on Linux, configure the gateway address instead")
+}
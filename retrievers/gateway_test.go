@@ -0,0 +1,187 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const igdDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+const soapResponse = `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>%s</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body>
+</s:Envelope>`
+
+// newFakeIGD starts an internet gateway device that reports the given WAN address. The SSDP address of the device
+// is returned
+func newFakeIGD(t *testing.T, wanAddr string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			fmt.Fprint(w, igdDescription)
+		case "/ctl/IPConn":
+			body, _ := io.ReadAll(r.Body)
+			action := r.Header.Get("SOAPAction")
+			if action != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` || !strings.Contains(string(body), "GetExternalIPAddress") {
+				http.Error(w, "unknown action "+action, http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintf(w, soapResponse, wanAddr)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// like a real device, only searches addressed to the device are answered
+			search := string(buf[:n])
+			if !strings.HasPrefix(search, "M-SEARCH") || !strings.Contains(search, "\r\nHOST: "+conn.LocalAddr().String()+"\r\n") {
+				continue
+			}
+
+			resp := fmt.Sprintf("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\nLOCATION: %s/rootDesc.xml\r\n\r\n", server.URL)
+			conn.WriteTo([]byte(resp), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// newFakeNATPMP starts a NAT-PMP gateway that answers with the given response
+func newFakeNATPMP(t *testing.T, response []byte) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n == 2 && buf[0] == natpmpVersion && buf[1] == natpmpOpExternalAddress {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// unusedUDPAddr returns an address nothing listens on, so that requests to it time out
+func unusedUDPAddr(t *testing.T) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func newTestGatewayRetriever(ssdpAddr, gateway string) *GatewayRetriever {
+	r := NewGatewayRetriever(gateway)
+	r.SSDPAddr = ssdpAddr
+	r.DiscoveryTimeout = 200 * time.Millisecond
+	r.Timeout = time.Second
+	return r
+}
+
+func TestGatewayRetriever(t *testing.T) {
+	t.Run("UPnP GetExternalIPAddress", func(t *testing.T) {
+		r := newTestGatewayRetriever(newFakeIGD(t, "203.0.113.20"), unusedUDPAddr(t))
+
+		ip, err := r.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.20" {
+			t.Errorf("Got %s. Wanted 203.0.113.20", ip)
+		}
+	})
+
+	t.Run("Falls back to NAT-PMP", func(t *testing.T) {
+		response := []byte{0, 128, 0, 0, 0, 0, 0, 1, 203, 0, 113, 21}
+		r := newTestGatewayRetriever(unusedUDPAddr(t), newFakeNATPMP(t, response))
+
+		ip, err := r.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.21" {
+			t.Errorf("Got %s. Wanted 203.0.113.21", ip)
+		}
+	})
+
+	t.Run("NAT-PMP error", func(t *testing.T) {
+		response := []byte{0, 128, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0}
+		r := newTestGatewayRetriever(unusedUDPAddr(t), newFakeNATPMP(t, response))
+
+		if _, err := r.Get(context.Background()); !errors.Is(err, ErrNoGateway) {
+			t.Errorf("Got %v. Wanted %v", err, ErrNoGateway)
+		}
+	})
+
+	t.Run("CGNAT address is flagged", func(t *testing.T) {
+		r := newTestGatewayRetriever(newFakeIGD(t, "100.72.1.2"), unusedUDPAddr(t))
+
+		if _, err := r.Get(context.Background()); !errors.Is(err, ErrCGNAT) {
+			t.Errorf("Got %v. Wanted %v", err, ErrCGNAT)
+		}
+	})
+
+	t.Run("Private address is flagged", func(t *testing.T) {
+		r := newTestGatewayRetriever(newFakeIGD(t, "192.168.0.10"), unusedUDPAddr(t))
+
+		if _, err := r.Get(context.Background()); !errors.Is(err, ErrPrivateWANAddress) {
+			t.Errorf("Got %v. Wanted %v", err, ErrPrivateWANAddress)
+		}
+	})
+}
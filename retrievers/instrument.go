@@ -0,0 +1,29 @@
+package retrievers
+
+import (
+	"context"
+	"time"
+
+	"github.com/burmudar/cloudflare-dns/metrics"
+)
+
+// InstrumentedRetriever records the result and latency of every retrieval of the wrapped retriever in the ip
+// retriever metrics
+type InstrumentedRetriever struct {
+	Name      string
+	Family    Family
+	Retriever StringRetriever
+}
+
+// Instrument wraps r so that its retrievals are recorded under name and family
+func Instrument(name string, family Family, r StringRetriever) *InstrumentedRetriever {
+	return &InstrumentedRetriever{Name: name, Family: family, Retriever: r}
+}
+
+func (r *InstrumentedRetriever) Get(ctx context.Context) (string, error) {
+	start := time.Now()
+	ip, err := r.Retriever.Get(ctx)
+	metrics.ObserveRetrieval(r.Name, r.Family.String(), ip, err, time.Since(start))
+
+	return ip, err
+}
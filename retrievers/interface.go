@@ -0,0 +1,127 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+var ErrNoInterfaceAddress = errors.New("No usable address found on interface")
+
+// interfaceAddr is an address assigned to an interface. Flags are only known on platforms that report them
+type interfaceAddr struct {
+	Addr       netip.Addr
+	Temporary  bool
+	Deprecated bool
+	// Tentative addresses have not passed duplicate address detection yet, or failed it
+	Tentative bool
+}
+
+// InterfaceRetriever retrieves an address assigned to a local network interface. Link-local addresses are always
+// skipped, as are temporary, deprecated and tentative IPv6 addresses on platforms that report them. When Prefix is
+// valid only addresses within it are used. The first remaining address of Family is returned
+type InterfaceRetriever struct {
+	Interface string
+	Family    Family
+	Prefix    netip.Prefix
+
+	addrs func(name string) ([]interfaceAddr, error)
+}
+
+func NewInterfaceRetriever(name string, family Family, prefix netip.Prefix) *InterfaceRetriever {
+	return &InterfaceRetriever{
+		Interface: name,
+		Family:    family,
+		Prefix:    prefix,
+		addrs:     interfaceAddrs,
+	}
+}
+
+func (r *InterfaceRetriever) Get(ctx context.Context) (string, error) {
+	addrs, err := r.addrs(r.Interface)
+	if err != nil {
+		return "", fmt.Errorf("failed to list addresses of interface %s: %w", r.Interface, err)
+	}
+
+	var skipped []string
+	for _, a := range addrs {
+		if reason := r.skipReason(a); reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", a.Addr, reason))
+			continue
+		}
+
+		return a.Addr.String(), nil
+	}
+
+	if len(skipped) == 0 {
+		return "", fmt.Errorf("%w %s: the interface has no addresses", ErrNoInterfaceAddress, r.Interface)
+	}
+
+	return "", fmt.Errorf("%w %s. Skipped %s", ErrNoInterfaceAddress, r.Interface, strings.Join(skipped, ", "))
+}
+
+// skipReason returns why the address cannot be used, or an empty string when it can be used
+func (r *InterfaceRetriever) skipReason(a interfaceAddr) string {
+	addr := a.Addr
+	switch {
+	case r.Family == IPv4 && !addr.Is4():
+		return "not IPv4"
+	case r.Family == IPv6 && !addr.Is6():
+		return "not IPv6"
+	case addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast():
+		return "link-local"
+	case addr.IsUnspecified() || addr.IsMulticast():
+		return "not a unicast address"
+	case a.Temporary:
+		return "temporary"
+	case a.Deprecated:
+		return "deprecated"
+	case a.Tentative:
+		return "tentative"
+	case r.Prefix.IsValid() && !r.Prefix.Contains(addr):
+		return "outside " + r.Prefix.String()
+	}
+
+	return ""
+}
+
+// interfaceAddrs lists the addresses of the named interface together with the flags the platform reports
+func interfaceAddrs(name string) ([]interfaceAddr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	netAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := ipv6AddrFlags(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []interfaceAddr
+	for _, na := range netAddrs {
+		ipNet, ok := na.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+
+		a := flags[addr]
+		a.Addr = addr
+		addrs = append(addrs, a)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package retrievers
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Address flags reported in /proc/net/if_inet6, see include/uapi/linux/if_addr.h
+const (
+	ifaFlagTemporary  = 0x01
+	ifaFlagDADFailed  = 0x08
+	ifaFlagDeprecated = 0x20
+	ifaFlagTentative  = 0x40
+)
+
+// ipv6AddrFlags reads the flags of the IPv6 addresses of the named interface from /proc/net/if_inet6. An empty map
+// is returned when IPv6 is disabled
+func ipv6AddrFlags(name string) (map[netip.Addr]interfaceAddr, error) {
+	f, err := os.Open("/proc/net/if_inet6")
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[netip.Addr]interfaceAddr{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseIfInet6(f, name)
+}
+
+// parseIfInet6 parses lines in the format of /proc/net/if_inet6, which are the address in hex, interface index,
+// prefix length, scope, flags and interface name
+func parseIfInet6(r io.Reader, name string) (map[netip.Addr]interfaceAddr, error) {
+	result := make(map[netip.Addr]interfaceAddr)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[5] != name {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[0])
+		addr, ok := netip.AddrFromSlice(raw)
+		if err != nil || !ok || !addr.Is6() {
+			return nil, fmt.Errorf("invalid address '%s' in if_inet6", fields[0])
+		}
+		flags, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flags '%s' in if_inet6", fields[4])
+		}
+
+		result[addr] = interfaceAddr{
+			Addr:       addr,
+			Temporary:  flags&ifaFlagTemporary != 0,
+			Deprecated: flags&ifaFlagDeprecated != 0,
+			Tentative:  flags&(ifaFlagTentative|ifaFlagDADFailed) != 0,
+		}
+	}
+
+	return result, scanner.Err()
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package retrievers
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseIfInet6(t *testing.T) {
+	content := `00000000000000000000000000000001 01 80 10 80       lo
+20010db8000000000000000000000001 02 40 00 80     eth0
+20010db80000000000000000000000aa 02 40 00 01     eth0
+20010db80000000000000000000000bb 02 40 00 20     eth0
+20010db80000000000000000000000cc 02 40 00 c0     eth0
+fe800000000000000000000000000001 02 40 20 80     eth0
+`
+
+	flags, err := parseIfInet6(strings.NewReader(content), "eth0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(flags) != 5 {
+		t.Errorf("Got %d addresses. Wanted 5 addresses of eth0", len(flags))
+	}
+
+	for addr, wanted := range map[string]interfaceAddr{
+		"2001:db8::1":  {},
+		"2001:db8::aa": {Temporary: true},
+		"2001:db8::bb": {Deprecated: true},
+		"2001:db8::cc": {Tentative: true},
+	} {
+		got, ok := flags[netip.MustParseAddr(addr)]
+		if !ok {
+			t.Errorf("Address %s not found", addr)
+			continue
+		}
+		if got.Temporary != wanted.Temporary || got.Deprecated != wanted.Deprecated || got.Tentative != wanted.Tentative {
+			t.Errorf("Got %+v. Wanted %+v for %s", got, wanted, addr)
+		}
+	}
+}
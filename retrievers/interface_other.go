@@ -0,0 +1,10 @@
+//go:build !linux
+
+package retrievers
+
+import "net/netip"
+
+// ipv6AddrFlags returns no flags, since only Linux reports whether an address is temporary or deprecated
+func ipv6AddrFlags(name string) (map[netip.Addr]interfaceAddr, error) {
+	return map[netip.Addr]interfaceAddr{}, nil
+}
@@ -0,0 +1,63 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestInterfaceRetriever(t *testing.T) {
+	addrs := []interfaceAddr{
+		{Addr: netip.MustParseAddr("fe80::1")},
+		{Addr: netip.MustParseAddr("2001:db8::aaaa"), Temporary: true},
+		{Addr: netip.MustParseAddr("2001:db8::bbbb"), Deprecated: true},
+		{Addr: netip.MustParseAddr("2001:db8::cccc"), Tentative: true},
+		{Addr: netip.MustParseAddr("169.254.10.1")},
+		{Addr: netip.MustParseAddr("192.168.1.10")},
+		{Addr: netip.MustParseAddr("10.8.0.1")},
+		{Addr: netip.MustParseAddr("2001:db8::1")},
+	}
+
+	for _, tc := range []struct {
+		name   string
+		family Family
+		prefix string
+		want   string
+	}{
+		{"First IPv4 address", IPv4, "", "192.168.1.10"},
+		{"IPv4 address within cidr", IPv4, "10.0.0.0/8", "10.8.0.1"},
+		{"Stable IPv6 address", IPv6, "", "2001:db8::1"},
+		{"No address within cidr", IPv6, "fd00::/8", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var prefix netip.Prefix
+			if tc.prefix != "" {
+				prefix = netip.MustParsePrefix(tc.prefix)
+			}
+
+			retriever := NewInterfaceRetriever("wg0", tc.family, prefix)
+			retriever.addrs = func(name string) ([]interfaceAddr, error) {
+				if name != "wg0" {
+					t.Errorf("Got interface %s. Wanted wg0", name)
+				}
+				return addrs, nil
+			}
+
+			ip, err := retriever.Get(context.Background())
+			if tc.want == "" {
+				if !errors.Is(err, ErrNoInterfaceAddress) {
+					t.Errorf("Got %v. Wanted %v", err, ErrNoInterfaceAddress)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ip != tc.want {
+				t.Errorf("Got %s. Wanted %s", ip, tc.want)
+			}
+		})
+	}
+}
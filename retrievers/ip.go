@@ -0,0 +1,92 @@
+package retrievers
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrInvalidIP is matched by every *InvalidIPError
+var ErrInvalidIP = errors.New("Invalid ip")
+
+// maxBodyInError is the number of bytes of a body included in an InvalidIPError, so that a whole HTML page does not
+// end up in the logs
+const maxBodyInError = 64
+
+// Family is the address family an ip is expected to be in
+type Family int
+
+const (
+	AnyFamily Family = iota
+	IPv4
+	IPv6
+)
+
+func (f Family) String() string {
+	switch f {
+	case IPv4:
+		return "IPv4"
+	case IPv6:
+		return "IPv6"
+	default:
+		return "IP"
+	}
+}
+
+// InvalidIPError is returned when a retrieved body is not exactly one ip of the expected family
+type InvalidIPError struct {
+	// Body is the content that was retrieved
+	Body   string
+	Family Family
+	Reason string
+}
+
+func (e *InvalidIPError) Error() string {
+	body := e.Body
+	if len(body) > maxBodyInError {
+		body = body[:maxBodyInError] + "..."
+	}
+
+	return fmt.Sprintf("expected a single %s address, but %s. Got %q", e.Family, e.Reason, body)
+}
+
+func (e *InvalidIPError) Is(target error) bool {
+	return target == ErrInvalidIP
+}
+
+// ParseIP parses content that should be exactly one ip of the given family. Surrounding whitespace is ignored and
+// IPv4-mapped IPv6 addresses are treated as IPv4 addresses
+func ParseIP(content string, family Family) (netip.Addr, error) {
+	invalid := func(reason string) (netip.Addr, error) {
+		return netip.Addr{}, &InvalidIPError{Body: content, Family: family, Reason: reason}
+	}
+
+	value := strings.TrimSpace(content)
+	if value == "" {
+		return invalid("the content is empty")
+	}
+	if strings.ContainsAny(value, " \t\r\n") {
+		return invalid("the content contains more than one value")
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return invalid("the content is not an ip address")
+	}
+	if addr.Zone() != "" {
+		return invalid("the address has a zone")
+	}
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+	}
+
+	switch {
+	case family == IPv4 && !addr.Is4():
+		return invalid("an IPv6 address was returned")
+	case family == IPv6 && !addr.Is6():
+		return invalid("an IPv4 address was returned")
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,88 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseIP(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		family  Family
+		want    string
+		wantErr bool
+	}{
+		{"1.2.3.4\n", IPv4, "1.2.3.4", false},
+		{"  2001:db8::1 ", IPv6, "2001:db8::1", false},
+		{"2001:0db8:0000::0001", AnyFamily, "2001:db8::1", false},
+		{"::ffff:1.2.3.4", IPv4, "1.2.3.4", false},
+		{"::ffff:1.2.3.4", IPv6, "", true},
+		{"1.2.3.4", IPv6, "", true},
+		{"2001:db8::1", IPv4, "", true},
+		{"", AnyFamily, "", true},
+		{"1.2.3.4 5.6.7.8", AnyFamily, "", true},
+		{"999.999.999.999", IPv4, "", true},
+		{"fe80::1%eth0", IPv6, "", true},
+		{"<html><body>Please log in to the wifi</body></html>", IPv4, "", true},
+	} {
+		t.Run(fmt.Sprintf("%q as %s", tc.content, tc.family), func(t *testing.T) {
+			addr, err := ParseIP(tc.content, tc.family)
+			if tc.wantErr {
+				var invalidErr *InvalidIPError
+				if !errors.As(err, &invalidErr) || !errors.Is(err, ErrInvalidIP) {
+					t.Fatalf("Got %v. Wanted an InvalidIPError", err)
+				}
+				if invalidErr.Body != tc.content {
+					t.Errorf("Got body %q. Wanted %q", invalidErr.Body, tc.content)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if addr.String() != tc.want {
+				t.Errorf("Got %s. Wanted %s", addr, tc.want)
+			}
+		})
+	}
+}
+
+func TestIPRetrieverDoesNotCacheInvalidIPs(t *testing.T) {
+	bodies := []string{"<html>captive portal</html>", "1.2.3.4\n"}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := bodies[len(bodies)-1]
+		if requests < len(bodies) {
+			body = bodies[requests]
+		}
+		requests++
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	retriever := NewIPRetriever(server.Client(), server.URL, IPv4, time.Minute)
+
+	if _, err := retriever.Get(context.Background()); !errors.Is(err, ErrInvalidIP) {
+		t.Fatalf("Got %v. Wanted %v", err, ErrInvalidIP)
+	}
+
+	for i := 0; i < 2; i++ {
+		ip, err := retriever.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "1.2.3.4" {
+			t.Errorf("Got %s. Wanted 1.2.3.4", ip)
+		}
+	}
+
+	if requests != 2 {
+		t.Errorf("Got %d requests. Wanted 2, since only the valid ip is cached", requests)
+	}
+}
@@ -0,0 +1,72 @@
+package retrievers
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// NAT-PMP from RFC 6886. PCP servers answer NAT-PMP requests for backwards compatibility, see RFC 6887 appendix A
+const (
+	natpmpPort                = "5351"
+	natpmpVersion             = 0
+	natpmpOpExternalAddress   = 0
+	natpmpResponseBit         = 128
+	natpmpExternalAddressSize = 12
+)
+
+var natpmpResultCodes = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// natpmpExternalIP asks the gateway for its external address with NAT-PMP
+func (r *GatewayRetriever) natpmpExternalIP(ctx context.Context) (netip.Addr, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	gateway := r.Gateway
+	if gateway == "" {
+		addr, err := defaultGateway()
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("failed to find the default gateway: %w", err)
+		}
+		gateway = addr.String()
+	}
+	gateway = withDefaultPort(gateway, natpmpPort)
+
+	var addr netip.Addr
+	request := []byte{natpmpVersion, natpmpOpExternalAddress}
+	err := exchangeUDP(ctx, "udp4", gateway, request, func(response []byte) (bool, error) {
+		if len(response) < 4 || response[1] != natpmpResponseBit|natpmpOpExternalAddress {
+			return false, nil
+		}
+
+		if code := binary.BigEndian.Uint16(response[2:4]); code != 0 {
+			reason, ok := natpmpResultCodes[code]
+			if !ok {
+				reason = fmt.Sprintf("result code %d", code)
+			}
+			return true, errors.New(reason)
+		}
+		if response[0] != natpmpVersion || len(response) < natpmpExternalAddressSize {
+			return true, fmt.Errorf("invalid response of %d bytes", len(response))
+		}
+
+		addr = netip.AddrFrom4([4]byte{response[8], response[9], response[10], response[11]})
+		return true, nil
+	})
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("request to %s failed: %w", gateway, err)
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,128 @@
+package retrievers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrUnexpectedResponse = errors.New("Response does not contain an ip")
+
+// Formats of the responses NewResponseParser creates a parser for
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatRegex = "regex"
+)
+
+// ResponseParser extracts the ip from the body of a response
+type ResponseParser interface {
+	Parse(body []byte) (string, error)
+}
+
+// NewResponseParser creates the parser for responses in format: text, json or regex. An empty format is text. The
+// json format uses the ip at path and the regex format the ip matched by pattern
+func NewResponseParser(format, path, pattern string) (ResponseParser, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatText:
+		return TextParser{}, nil
+	case FormatJSON:
+		p, err := NewJSONParser(path)
+		if err != nil {
+			return nil, fmt.Errorf("format json: %w", err)
+		}
+		return p, nil
+	case FormatRegex:
+		p, err := NewRegexParser(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("format regex: %w", err)
+		}
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%s'. Use text, json or regex", format)
+	}
+}
+
+// TextParser uses the whole body, which should be the ip in plain text
+type TextParser struct{}
+
+func (TextParser) Parse(body []byte) (string, error) {
+	return string(body), nil
+}
+
+// JSONParser uses the string found at Path in a JSON body. Path is a list of object keys and array indexes
+// separated by dots, e.g. "ip" or "addresses.0.value"
+type JSONParser struct {
+	Path string
+}
+
+func NewJSONParser(path string) (*JSONParser, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("a JSON path is required")
+	}
+
+	return &JSONParser{Path: path}, nil
+}
+
+func (p *JSONParser) Parse(body []byte) (string, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "", fmt.Errorf("%w: invalid JSON: %v", ErrUnexpectedResponse, err)
+	}
+
+	for _, key := range strings.Split(p.Path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("%w: field '%s' of path '%s' not found", ErrUnexpectedResponse, key, p.Path)
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("%w: index '%s' of path '%s' not found", ErrUnexpectedResponse, key, p.Path)
+			}
+			value = v[i]
+		default:
+			return "", fmt.Errorf("%w: '%s' of path '%s' is not an object or array", ErrUnexpectedResponse, key, p.Path)
+		}
+	}
+
+	ip, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: path '%s' is not a string", ErrUnexpectedResponse, p.Path)
+	}
+
+	return ip, nil
+}
+
+// RegexParser uses the first match of Pattern in the body. When the pattern has a capture group, the first group is
+// used instead of the whole match
+type RegexParser struct {
+	Pattern *regexp.Regexp
+}
+
+func NewRegexParser(pattern string) (*RegexParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() > 1 {
+		return nil, fmt.Errorf("pattern '%s' has %d capture groups, at most one is allowed", pattern, re.NumSubexp())
+	}
+
+	return &RegexParser{Pattern: re}, nil
+}
+
+func (p *RegexParser) Parse(body []byte) (string, error) {
+	match := p.Pattern.FindSubmatch(body)
+	if match == nil {
+		return "", fmt.Errorf("%w: pattern '%s' does not match", ErrUnexpectedResponse, p.Pattern)
+	}
+
+	return string(match[len(match)-1]), nil
+}
@@ -0,0 +1,78 @@
+package retrievers
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResponseParsers(t *testing.T) {
+	jsonBody := []byte(`{"ip":"203.0.113.1","country":"ZA","addresses":[{"value":"2001:db8::1"}],"asn":1234}`)
+
+	for _, tc := range []struct {
+		name    string
+		parser  func() (ResponseParser, error)
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{"Text", func() (ResponseParser, error) { return TextParser{}, nil }, []byte("203.0.113.1\n"), "203.0.113.1\n", false},
+		{"JSON field", func() (ResponseParser, error) { return NewJSONParser("ip") }, jsonBody, "203.0.113.1", false},
+		{"JSON nested path", func() (ResponseParser, error) { return NewJSONParser("addresses.0.value") }, jsonBody, "2001:db8::1", false},
+		{"JSON missing field", func() (ResponseParser, error) { return NewJSONParser("address") }, jsonBody, "", true},
+		{"JSON index out of range", func() (ResponseParser, error) { return NewJSONParser("addresses.1.value") }, jsonBody, "", true},
+		{"JSON field is not a string", func() (ResponseParser, error) { return NewJSONParser("asn") }, jsonBody, "", true},
+		{"JSON invalid body", func() (ResponseParser, error) { return NewJSONParser("ip") }, []byte("<html>"), "", true},
+		{"Regex capture", func() (ResponseParser, error) { return NewRegexParser(`Current IP Address: ([0-9.]+)`) }, []byte("<body>Current IP Address: 203.0.113.1</body>"), "203.0.113.1", false},
+		{"Regex match", func() (ResponseParser, error) { return NewRegexParser(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`) }, []byte("ip=203.0.113.1;"), "203.0.113.1", false},
+		{"Regex without match", func() (ResponseParser, error) { return NewRegexParser(`ip=([0-9.]+)`) }, []byte("no ip here"), "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parser, err := tc.parser()
+			if err != nil {
+				t.Fatalf("Unexpected error creating parser: %v", err)
+			}
+
+			got, err := parser.Parse(tc.body)
+			if tc.wantErr {
+				if !errors.Is(err, ErrUnexpectedResponse) {
+					t.Errorf("Got %v. Wanted %v", err, ErrUnexpectedResponse)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Got %q. Wanted %q", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("Regex with multiple capture groups", func(t *testing.T) {
+		if _, err := NewRegexParser(`(a)(b)`); err == nil {
+			t.Errorf("Expected an error for a pattern with 2 capture groups")
+		}
+	})
+}
+
+func TestNewResponseParser(t *testing.T) {
+	for _, tc := range []struct {
+		format  string
+		path    string
+		pattern string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"text", "", "", false},
+		{"JSON", "ip", "", false},
+		{"json", "", "", true},
+		{"regex", "", `ip=([0-9.]+)`, false},
+		{"regex", "", `(a)(b)`, true},
+		{"xml", "", "", true},
+	} {
+		_, err := NewResponseParser(tc.format, tc.path, tc.pattern)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Got %v. Wanted error %t for format %q", err, tc.wantErr, tc.format)
+		}
+	}
+}
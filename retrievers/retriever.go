@@ -1,57 +1,133 @@
 package retrievers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
-	"strings"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
-var DefaultIPRetriever = NewIPRetriever(http.DefaultClient, "http://ifconfig.co", 30*time.Second)
+// DefaultTimeout is the maximum duration of a single request made by a URLRetriever
+const DefaultTimeout = 10 * time.Second
 
+// MaxBodySize is the maximum number of bytes read from a response. Larger responses are treated as failures
+const MaxBodySize = 64 * 1024
+
+var ErrBodyTooLarge = errors.New("Response body is too large")
+
+// DefaultHTTPClient is used by retrievers that are not given a client. Unlike http.DefaultClient, a request can
+// never hang forever
+var DefaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+// DefaultIPv4URLs are the "what is my IP" endpoints queried for the public IPv4 address. ifconfig.co comes first,
+// since it was the only endpoint before, the others are only queried to reach a quorum
+var DefaultIPv4URLs = []string{"https://ifconfig.co", "https://api4.ipify.org", "https://ipv4.icanhazip.com"}
+
+// DefaultIPv6URLs are the "what is my IP" endpoints queried for the public IPv6 address
+var DefaultIPv6URLs = []string{"https://ifconfig.co", "https://api6.ipify.org", "https://ipv6.icanhazip.com"}
+
+// DefaultQuorum is the number of endpoints that have to agree on the ip
+const DefaultQuorum = 2
+
+// DefaultIPRetriever retrieves the public IPv4 address from DefaultIPv4URLs
+var DefaultIPRetriever = NewConsensusURLRetriever(DefaultIPv4HTTPClient, DefaultIPv4URLs, IPv4, DefaultQuorum, 30*time.Second)
+
+// DefaultIPv6Retriever retrieves the public IPv6 address from DefaultIPv6URLs
+var DefaultIPv6Retriever = NewConsensusURLRetriever(DefaultIPv6HTTPClient, DefaultIPv6URLs, IPv6, DefaultQuorum, 30*time.Second)
+
+// StatusError is returned when a url responds with a non 2xx status code
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// Body is the start of the response body, which usually explains the failure
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request to '%s' failed with response code <%d> Body: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// URLRetriever retrieves the body of a url. Every request is cancelled after Timeout, and bodies larger than
+// MaxBodySize are rejected. It is safe for concurrent use
 type URLRetriever struct {
-	URL    string
-	client *http.Client
+	URL     string
+	Timeout time.Duration
+	client  *http.Client
 }
 
+// NewURLRetriever creates a URLRetriever with DefaultTimeout. DefaultHTTPClient is used when client is nil
 func NewURLRetriever(url string, client *http.Client) *URLRetriever {
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+
 	return &URLRetriever{
-		URL:    url,
-		client: client,
+		URL:     url,
+		Timeout: DefaultTimeout,
+		client:  client,
 	}
 }
 
-func (u *URLRetriever) Get() ([]byte, error) {
-	resp, err := u.client.Get(u.URL)
+func (u *URLRetriever) Get(ctx context.Context) ([]byte, error) {
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.URL, nil)
 	if err != nil {
-		fmt.Printf("Error while making a request to '%s': %v\n", u.URL, err)
+		return nil, err
 	}
 
-	return ioutil.ReadAll(resp.Body)
-}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to '%s' failed: %w", u.URL, err)
+	}
+	defer resp.Body.Close()
 
-type ipRetriever struct {
-	IP         *atomic.Value
-	client     ByteRetriever
-	TTL        time.Duration
-	cacheTimer *time.Timer
+	// one byte more than the limit is read, to tell a body of exactly MaxBodySize apart from a larger body
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from '%s': %w", u.URL, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body := data
+		if len(body) > maxBodyInError {
+			body = body[:maxBodyInError]
+		}
+		return nil, &StatusError{URL: u.URL, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if len(data) > MaxBodySize {
+		return nil, fmt.Errorf("response from '%s' exceeds %d bytes: %w", u.URL, MaxBodySize, ErrBodyTooLarge)
+	}
+
+	return data, nil
 }
 
-func (r *ipRetriever) initCacheTimer() {
-	r.cacheTimer = time.AfterFunc(r.TTL, func() {
-		r.IP.Store("")
-		r.initCacheTimer()
-	})
+// ipRetriever retrieves an ip and caches it until TTL has passed. Only valid ips are cached
+type ipRetriever struct {
+	client ByteRetriever
+	parser ResponseParser
+	family Family
+	TTL    time.Duration
+
+	mu      sync.Mutex
+	ip      string
+	expires time.Time
 }
 
 type ByteRetriever interface {
-	Get() ([]byte, error)
+	Get(ctx context.Context) ([]byte, error)
 }
 
 type StringRetriever interface {
-	Get() (string, error)
+	Get(ctx context.Context) (string, error)
 }
 
 type StaticStringRetriever struct {
@@ -62,35 +138,53 @@ func NewStaticStringRetriever(value string) *StaticStringRetriever {
 	return &StaticStringRetriever{value}
 }
 
-func (s *StaticStringRetriever) Get() (string, error) {
+func (s *StaticStringRetriever) Get(ctx context.Context) (string, error) {
 	return s.value, nil
 }
 
-func NewIPRetriever(client *http.Client, queryURL string, ttl time.Duration) *ipRetriever {
-	retriever := &ipRetriever{
-		IP:     &atomic.Value{},
+// NewIPRetriever creates a retriever that expects the body returned by queryURL to be a single ip of the given
+// family in plain text. Valid ips are cached for ttl
+func NewIPRetriever(client *http.Client, queryURL string, family Family, ttl time.Duration) *ipRetriever {
+	return NewParsedIPRetriever(client, queryURL, TextParser{}, family, ttl)
+}
+
+// NewParsedIPRetriever creates a retriever that extracts the ip from the body returned by queryURL with parser
+func NewParsedIPRetriever(client *http.Client, queryURL string, parser ResponseParser, family Family, ttl time.Duration) *ipRetriever {
+	return &ipRetriever{
 		client: NewURLRetriever(queryURL, client),
+		parser: parser,
+		family: family,
 		TTL:    ttl,
 	}
-
-	retriever.initCacheTimer()
-
-	return retriever
 }
 
-func (r *ipRetriever) Get() (string, error) {
-	ip, _ := r.IP.Load().(string)
-	if ip != "" {
+func (r *ipRetriever) Get(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	ip, expires := r.ip, r.expires
+	r.mu.Unlock()
+	if ip != "" && time.Now().Before(expires) {
 		return ip, nil
 	}
 
-	data, err := r.client.Get()
+	data, err := r.client.Get(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Failed to retrieve content: %w", err)
+	}
+
+	content, err := r.parser.Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := ParseIP(content, r.family)
 	if err != nil {
-		return "", fmt.Errorf("Failed to retrieve content: %v", err)
+		return "", err
 	}
 
-	newIP := strings.TrimSpace(string(data))
-	r.IP.Store(newIP)
+	newIP := addr.String()
+	r.mu.Lock()
+	r.ip, r.expires = newIP, time.Now().Add(r.TTL)
+	r.mu.Unlock()
 
-	return newIP, err
+	return newIP, nil
 }
@@ -0,0 +1,85 @@
+package retrievers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLRetriever(t *testing.T) {
+	t.Run("Returns the body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("1.2.3.4\n"))
+		}))
+		defer server.Close()
+
+		data, err := NewURLRetriever(server.URL, server.Client()).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(data) != "1.2.3.4\n" {
+			t.Errorf("Got %q. Wanted %q", data, "1.2.3.4\n")
+		}
+	})
+
+	t.Run("Non 2xx response is an error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		_, err := NewURLRetriever(server.URL, server.Client()).Get(context.Background())
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("Got %v. Wanted a StatusError", err)
+		}
+		if statusErr.StatusCode != http.StatusTooManyRequests || !strings.Contains(statusErr.Body, "slow down") {
+			t.Errorf("Got %+v. Wanted status 429 with the body", statusErr)
+		}
+	})
+
+	t.Run("Large body is an error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(strings.Repeat("a", MaxBodySize+1)))
+		}))
+		defer server.Close()
+
+		_, err := NewURLRetriever(server.URL, server.Client()).Get(context.Background())
+		if !errors.Is(err, ErrBodyTooLarge) {
+			t.Errorf("Got %v. Wanted %v", err, ErrBodyTooLarge)
+		}
+	})
+
+	t.Run("Slow response times out", func(t *testing.T) {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-done:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(done)
+
+		retriever := NewURLRetriever(server.URL, server.Client())
+		retriever.Timeout = 50 * time.Millisecond
+
+		if _, err := retriever.Get(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Got %v. Wanted %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("Unreachable url is an error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		url := server.URL
+		server.Close()
+
+		if _, err := NewURLRetriever(url, nil).Get(context.Background()); err == nil {
+			t.Errorf("Expected an error for an unreachable url")
+		}
+	})
+}
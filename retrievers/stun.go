@@ -0,0 +1,215 @@
+package retrievers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// DefaultSTUNServers are public STUN servers that are queried in order
+var DefaultSTUNServers = []string{"stun.cloudflare.com:3478", "stun.l.google.com:19302", "stun1.l.google.com:19302"}
+
+var ErrNoMappedAddress = errors.New("STUN response contains no mapped address")
+
+// STUN message types and attributes from RFC 5389
+const (
+	stunMagicCookie        = 0x2112A442
+	stunHeaderSize         = 20
+	stunBindingRequest     = 0x0001
+	stunBindingSuccess     = 0x0101
+	stunBindingError       = 0x0111
+	stunAttrMappedAddress  = 0x0001
+	stunAttrErrorCode      = 0x0009
+	stunAttrXORMappedAddr  = 0x0020
+	stunAddressFamilyIPv4  = 0x01
+	stunAddressFamilyIPv6  = 0x02
+	stunTransactionIDBytes = 12
+)
+
+// STUNRetriever retrieves the public ip with a STUN binding request, which the server answers with the address the
+// request was received from. The servers are queried over UDP in order until one of them answers
+type STUNRetriever struct {
+	// Servers are host:port addresses. The port defaults to 3478
+	Servers []string
+	Family  Family
+	// Timeout is the maximum duration of a request to a single server
+	Timeout time.Duration
+}
+
+// NewSTUNRetriever creates a STUNRetriever with DefaultTimeout. When no servers are given, DefaultSTUNServers are
+// used
+func NewSTUNRetriever(family Family, servers ...string) *STUNRetriever {
+	if len(servers) == 0 {
+		servers = DefaultSTUNServers
+	}
+
+	return &STUNRetriever{
+		Servers: servers,
+		Family:  family,
+		Timeout: DefaultTimeout,
+	}
+}
+
+func (r *STUNRetriever) Get(ctx context.Context) (string, error) {
+	if len(r.Servers) == 0 {
+		return "", errors.New("no STUN servers configured")
+	}
+
+	var errs []string
+	for _, server := range r.Servers {
+		ip, err := r.bind(ctx, withDefaultPort(server, "3478"))
+		if err == nil {
+			return ip, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+
+		errs = append(errs, err.Error())
+	}
+
+	return "", fmt.Errorf("all STUN servers failed: %s", strings.Join(errs, ", "))
+}
+
+// bind sends a binding request to the server and returns the mapped address in the response
+func (r *STUNRetriever) bind(ctx context.Context, server string) (string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	var transactionID [stunTransactionIDBytes]byte
+	if _, err := rand.Read(transactionID[:]); err != nil {
+		return "", err
+	}
+
+	var ip string
+	err := exchangeUDP(ctx, udpNetwork(r.Family), server, stunBindingRequestMessage(transactionID), func(response []byte) (bool, error) {
+		addr, ok, err := parseSTUNResponse(response, transactionID)
+		if !ok {
+			return false, nil
+		}
+		if err != nil {
+			return true, err
+		}
+
+		parsed, err := ParseIP(addr.String(), r.Family)
+		if err != nil {
+			return true, err
+		}
+
+		ip = parsed.String()
+		return true, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("binding request to %s failed: %w", server, err)
+	}
+
+	return ip, nil
+}
+
+func stunBindingRequestMessage(transactionID [stunTransactionIDBytes]byte) []byte {
+	msg := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(msg[2:4], 0)
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], transactionID[:])
+
+	return msg
+}
+
+// parseSTUNResponse returns the mapped address in a binding response. ok is false when the message is not a
+// response to the transaction, in which case it should be ignored
+func parseSTUNResponse(msg []byte, transactionID [stunTransactionIDBytes]byte) (addr netip.Addr, ok bool, err error) {
+	if len(msg) < stunHeaderSize || binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie || !bytes.Equal(msg[8:20], transactionID[:]) {
+		return netip.Addr{}, false, nil
+	}
+
+	msgType := binary.BigEndian.Uint16(msg[0:2])
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if stunHeaderSize+length > len(msg) {
+		return netip.Addr{}, true, fmt.Errorf("STUN response is truncated")
+	}
+	attrs := msg[stunHeaderSize : stunHeaderSize+length]
+
+	var mapped, xorMapped netip.Addr
+	var errorCode string
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+attrLen > len(attrs) {
+			return netip.Addr{}, true, fmt.Errorf("STUN attribute 0x%04x is truncated", attrType)
+		}
+		value := attrs[4 : 4+attrLen]
+
+		switch attrType {
+		case stunAttrMappedAddress:
+			mapped = parseSTUNAddress(value, nil)
+		case stunAttrXORMappedAddr:
+			xorMapped = parseSTUNAddress(value, msg[4:20])
+		case stunAttrErrorCode:
+			if len(value) >= 4 {
+				errorCode = fmt.Sprintf("%d %s", int(value[2]&0x07)*100+int(value[3]), value[4:])
+			}
+		}
+
+		// attributes are padded to a multiple of 4 bytes
+		padded := (attrLen + 3) &^ 3
+		if 4+padded > len(attrs) {
+			break
+		}
+		attrs = attrs[4+padded:]
+	}
+
+	switch {
+	case msgType == stunBindingError:
+		return netip.Addr{}, true, fmt.Errorf("STUN server returned error %s", errorCode)
+	case msgType != stunBindingSuccess:
+		return netip.Addr{}, false, nil
+	case xorMapped.IsValid():
+		return xorMapped, true, nil
+	case mapped.IsValid():
+		return mapped, true, nil
+	default:
+		return netip.Addr{}, true, ErrNoMappedAddress
+	}
+}
+
+// parseSTUNAddress parses the value of a MAPPED-ADDRESS attribute. When key is given, the address is XOR-ed with it,
+// as for an XOR-MAPPED-ADDRESS attribute, where the key is the magic cookie followed by the transaction id
+func parseSTUNAddress(value []byte, key []byte) netip.Addr {
+	if len(value) < 4 {
+		return netip.Addr{}
+	}
+
+	var size int
+	switch value[1] {
+	case stunAddressFamilyIPv4:
+		size = 4
+	case stunAddressFamilyIPv6:
+		size = 16
+	default:
+		return netip.Addr{}
+	}
+	if len(value) < 4+size {
+		return netip.Addr{}
+	}
+
+	ip := make([]byte, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr
+}
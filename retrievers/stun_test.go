@@ -0,0 +1,146 @@
+package retrievers
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// newFakeSTUNServer answers every binding request with the response built by respond
+func newFakeSTUNServer(t *testing.T, respond func(request []byte, from netip.AddrPort) []byte) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderSize || binary.BigEndian.Uint16(buf[0:2]) != stunBindingRequest {
+				continue
+			}
+
+			from := addr.(*net.UDPAddr).AddrPort()
+			conn.WriteTo(respond(buf[:n], from), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// stunResponse builds a response to the request with the given message type and attributes
+func stunResponse(request []byte, msgType uint16, attrs ...[]byte) []byte {
+	var body []byte
+	for _, a := range attrs {
+		body = append(body, a...)
+	}
+
+	msg := make([]byte, stunHeaderSize, stunHeaderSize+len(body))
+	binary.BigEndian.PutUint16(msg[0:2], msgType)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(body)))
+	copy(msg[4:20], request[4:20])
+
+	return append(msg, body...)
+}
+
+// stunAddressAttr encodes addr as a MAPPED-ADDRESS or, when xor is true, an XOR-MAPPED-ADDRESS attribute
+func stunAddressAttr(request []byte, addr netip.AddrPort, xor bool) []byte {
+	ip := addr.Addr().AsSlice()
+	family := byte(stunAddressFamilyIPv4)
+	if addr.Addr().Is6() {
+		family = stunAddressFamilyIPv6
+	}
+
+	attrType := uint16(stunAttrMappedAddress)
+	port := addr.Port()
+	if xor {
+		attrType = stunAttrXORMappedAddr
+		port ^= uint16(stunMagicCookie >> 16)
+		for i := range ip {
+			ip[i] ^= request[4+i]
+		}
+	}
+
+	attr := make([]byte, 8, 8+len(ip))
+	binary.BigEndian.PutUint16(attr[0:2], attrType)
+	binary.BigEndian.PutUint16(attr[2:4], uint16(4+len(ip)))
+	attr[5] = family
+	binary.BigEndian.PutUint16(attr[6:8], port)
+
+	return append(attr, ip...)
+}
+
+func TestSTUNRetriever(t *testing.T) {
+	mapped := netip.MustParseAddrPort("203.0.113.9:40000")
+
+	t.Run("XOR-MAPPED-ADDRESS is preferred", func(t *testing.T) {
+		server := newFakeSTUNServer(t, func(request []byte, from netip.AddrPort) []byte {
+			return stunResponse(request, stunBindingSuccess,
+				stunAddressAttr(request, netip.MustParseAddrPort("198.51.100.1:1"), false),
+				stunAddressAttr(request, mapped, true),
+			)
+		})
+
+		ip, err := NewSTUNRetriever(IPv4, server).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.9" {
+			t.Errorf("Got %s. Wanted 203.0.113.9", ip)
+		}
+	})
+
+	t.Run("MAPPED-ADDRESS of old servers", func(t *testing.T) {
+		server := newFakeSTUNServer(t, func(request []byte, from netip.AddrPort) []byte {
+			return stunResponse(request, stunBindingSuccess, stunAddressAttr(request, from, false))
+		})
+
+		ip, err := NewSTUNRetriever(IPv4, server).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "127.0.0.1" {
+			t.Errorf("Got %s. Wanted 127.0.0.1", ip)
+		}
+	})
+
+	t.Run("Falls back to the next server", func(t *testing.T) {
+		failing := newFakeSTUNServer(t, func(request []byte, from netip.AddrPort) []byte {
+			errorCode := []byte{0, stunAttrErrorCode, 0, 8, 0, 0, 5, 0, 'f', 'a', 'i', 'l'}
+			return stunResponse(request, stunBindingError, errorCode)
+		})
+		server := newFakeSTUNServer(t, func(request []byte, from netip.AddrPort) []byte {
+			return stunResponse(request, stunBindingSuccess, stunAddressAttr(request, mapped, true))
+		})
+
+		ip, err := NewSTUNRetriever(IPv4, failing, server).Get(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ip != "203.0.113.9" {
+			t.Errorf("Got %s. Wanted 203.0.113.9", ip)
+		}
+	})
+
+	t.Run("XOR-MAPPED-ADDRESS with IPv6", func(t *testing.T) {
+		var transactionID [stunTransactionIDBytes]byte
+		copy(transactionID[:], "abcdefghijkl")
+		request := stunBindingRequestMessage(transactionID)
+		want := netip.MustParseAddrPort("[2001:db8::9]:40000")
+
+		addr, ok, err := parseSTUNResponse(stunResponse(request, stunBindingSuccess, stunAddressAttr(request, want, true)), transactionID)
+		if !ok || err != nil {
+			t.Fatalf("Unexpected result ok=%t err=%v", ok, err)
+		}
+		if addr != want.Addr() {
+			t.Errorf("Got %s. Wanted %s", addr, want.Addr())
+		}
+	})
+}
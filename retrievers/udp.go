@@ -0,0 +1,78 @@
+package retrievers
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// exchangeUDP sends the request to addr and passes every datagram that is received to handle, until handle returns
+// true or an error, or the context is done. Datagrams that are not a response to the request should be ignored by
+// returning false
+func exchangeUDP(ctx context.Context, network, addr string, request []byte, handle func(response []byte) (bool, error)) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// reads on a connection ignore the context, so the deadline is moved to now once the context is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := conn.Write(request); err != nil {
+		return ctxErr(ctx, err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return ctxErr(ctx, err)
+		}
+
+		if ok, err := handle(buf[:n]); err != nil || ok {
+			return err
+		}
+	}
+}
+
+// udpNetwork returns the network used to reach a server over the given family
+func udpNetwork(family Family) string {
+	switch family {
+	case IPv4:
+		return "udp4"
+	case IPv6:
+		return "udp6"
+	default:
+		return "udp"
+	}
+}
+
+// withDefaultPort adds the port to the address when it does not have one
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
+
+// ctxErr returns the error of the context when it is done, since the deadline error of the connection does not say
+// why the deadline was set
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
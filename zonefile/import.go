@@ -0,0 +1,292 @@
+package zonefile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+// ImportOptions configures how the records of a zone file are planned against the records of a zone
+type ImportOptions struct {
+	// Replace updates existing records with the same name and type but different content to the content in the
+	// zone file. When false, such records are reported as conflicts
+	Replace bool
+}
+
+// ConflictError is returned for a record of a zone file that cannot be imported into the zone
+type ConflictError struct {
+	Record dns.Record
+	// Existing is the record in the zone that conflicts with the record. It is nil when the record is not in the zone
+	Existing *model.DNSRecord
+	Reason   string
+	// Err is the error planning the record returned when its content is invalid
+	Err error
+}
+
+func (e *ConflictError) Error() string {
+	if e.Existing == nil {
+		return fmt.Sprintf("%s %s %s", e.Record.Type, e.Record.Name, e.Reason)
+	}
+
+	return fmt.Sprintf("%s %s conflicts with %s %s '%s': %s", e.Record.Type, e.Record.Name, e.Existing.Type, e.Existing.Name, e.Existing.Content, e.Reason)
+}
+
+// Is makes conflicts with an existing record match dns.ErrRecordExists
+func (e *ConflictError) Is(target error) bool {
+	return e.Existing != nil && target == dns.ErrRecordExists
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+type recordKey struct {
+	name       string
+	recordType string
+}
+
+func keyOf(name, recordType string) recordKey {
+	return recordKey{strings.ToLower(strings.TrimSuffix(name, ".")), strings.ToUpper(recordType)}
+}
+
+// PlanImport determines which records of a zone file have to be created or updated in the zone, and which are
+// unchanged. Records are matched to the records in the zone by name, type and content. Records that cannot be
+// imported are returned as ConflictErrors, while the other records are still planned. Existing records that are not
+// in the zone file are left as is
+func PlanImport(ctx context.Context, client dns.DNSClient, zoneName string, records []dns.Record, opts ImportOptions) ([]*dns.Change, []error, error) {
+	zone, err := dns.FindZone(ctx, client, zoneName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existing, err := client.ListRecords(ctx, zone.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := make(map[recordKey][]*model.DNSRecord)
+	cnames := make(map[string]*model.DNSRecord)
+	others := make(map[string]*model.DNSRecord)
+	for _, r := range existing {
+		key := keyOf(r.Name, r.Type)
+		current[key] = append(current[key], r)
+		if key.recordType == "CNAME" {
+			cnames[key.name] = r
+		} else {
+			others[key.name] = r
+		}
+	}
+
+	// the records of the zone file grouped by name and type, in the order they first appear
+	var keys []recordKey
+	desired := make(map[recordKey][]dns.Record)
+	for _, r := range records {
+		r.ZoneName = zone.Name
+		key := keyOf(r.Name, string(r.Type))
+		if _, ok := desired[key]; !ok {
+			keys = append(keys, key)
+		}
+		desired[key] = append(desired[key], r)
+	}
+
+	var changes []*dns.Change
+	var conflicts []error
+	for _, key := range keys {
+		var reason string
+		var conflicting *model.DNSRecord
+		switch {
+		case !inZone(key.name, zone.Name):
+			reason = "is not in zone " + zone.Name
+		case key.recordType == "CNAME" && others[key.name] != nil:
+			reason, conflicting = "a CNAME record cannot exist next to other records", others[key.name]
+		case key.recordType != "CNAME" && cnames[key.name] != nil:
+			reason, conflicting = "a CNAME record cannot exist next to other records", cnames[key.name]
+		}
+		if reason != "" {
+			for _, r := range desired[key] {
+				conflicts = append(conflicts, &ConflictError{Record: r, Existing: conflicting, Reason: reason})
+			}
+			continue
+		}
+
+		c, errs := planRRSet(ctx, client, zone, desired[key], current[key], opts)
+		changes = append(changes, c...)
+		conflicts = append(conflicts, errs...)
+	}
+
+	return changes, conflicts, nil
+}
+
+// WritePlan writes the changes like dns.WritePlan, followed by the records that conflict with the zone marked with
+// '!'. The summary also counts the conflicting records
+func WritePlan(w io.Writer, changes []*dns.Change, conflicts []error) {
+	counts := make(map[dns.Action]int)
+	for _, c := range changes {
+		fmt.Fprint(w, c.String())
+		counts[c.Action]++
+	}
+	for _, err := range conflicts {
+		fmt.Fprintf(w, "  ! %s\n", err)
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d unchanged, %d conflicting.\n", counts[dns.ActionCreate], counts[dns.ActionUpdate], counts[dns.ActionUnchanged], len(conflicts))
+}
+
+// planRRSet plans the records of the zone file with the same name and type against the existing records with that
+// name and type
+func planRRSet(ctx context.Context, client dns.DNSClient, zone *model.Zone, records []dns.Record, existing []*model.DNSRecord, opts ImportOptions) ([]*dns.Change, []error) {
+	var changes []*dns.Change
+	var conflicts []error
+
+	used := make(map[*model.DNSRecord]bool)
+	planned := make(map[string]bool)
+	var unmatched []dns.Record
+	for _, r := range records {
+		content := normaliseContent(string(r.Type), contentOf(r))
+		if planned[content] {
+			// the zone file contains the record more than once
+			continue
+		}
+		planned[content] = true
+
+		match := findContent(existing, used, string(r.Type), content)
+		if match == nil {
+			unmatched = append(unmatched, r)
+			continue
+		}
+		used[match] = true
+		changes = append(changes, planUpdate(r, match))
+	}
+
+	var replaceable []*model.DNSRecord
+	for _, e := range existing {
+		if !used[e] {
+			replaceable = append(replaceable, e)
+		}
+	}
+
+	for _, r := range unmatched {
+		if len(replaceable) == 0 {
+			if change, err := dns.PlanCreate(ctx, client, zone, r); err != nil {
+				conflicts = append(conflicts, &ConflictError{Record: r, Reason: err.Error(), Err: err})
+			} else {
+				changes = append(changes, change)
+			}
+			continue
+		}
+
+		if !opts.Replace {
+			conflicts = append(conflicts, &ConflictError{Record: r, Existing: replaceable[0], Reason: "the content differs, use --replace to update it"})
+			continue
+		}
+
+		changes = append(changes, planUpdate(r, replaceable[0]))
+		replaceable = replaceable[1:]
+	}
+
+	return changes, conflicts
+}
+
+// findContent returns the first record that is not used yet with the given normalised content
+func findContent(records []*model.DNSRecord, used map[*model.DNSRecord]bool, recordType, content string) *model.DNSRecord {
+	for _, r := range records {
+		if !used[r] && normaliseContent(recordType, r.Content) == content {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// planUpdate plans updating the existing record to the record of the zone file. When they are the same, the record
+// is unchanged
+func planUpdate(r dns.Record, existing *model.DNSRecord) *dns.Change {
+	proxied := existing.Proxied
+	if r.Proxied != nil {
+		proxied = *r.Proxied
+	}
+
+	priority := priorityOf(r.Priority, existing.Priority)
+	sameContent := normaliseContent(existing.Type, existing.Content) == normaliseContent(string(r.Type), contentOf(r))
+	samePriority := r.Priority == nil || existing.Priority == nil || *r.Priority == *existing.Priority
+	if sameContent && samePriority && proxied == existing.Proxied && r.TTL == existing.TTL {
+		return &dns.Change{Action: dns.ActionUnchanged, Record: r, Current: existing}
+	}
+
+	return &dns.Change{Action: dns.ActionUpdate, Record: r, Current: existing, Request: &model.DNSRecordRequest{
+		ID:       existing.ID,
+		ZoneID:   existing.ZoneID,
+		Name:     existing.Name,
+		Type:     existing.Type,
+		Content:  contentOf(r),
+		Proxied:  proxied,
+		Priority: priority,
+		TTL:      r.TTL,
+	}}
+}
+
+func priorityOf(priority, existing *int) int {
+	switch {
+	case priority != nil:
+		return *priority
+	case existing != nil:
+		return *existing
+	default:
+		return dns.DefaultPriority
+	}
+}
+
+// contentOf returns the content of the record, which is the IP of A and AAAA records
+func contentOf(r dns.Record) string {
+	if r.Type.IsAddress() {
+		return r.IP
+	}
+	return r.Content
+}
+
+func inZone(name, zone string) bool {
+	name, zone = strings.ToLower(name), strings.ToLower(zone)
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// normaliseContent returns the content in a form that can be compared, since Cloudflare might return content in a
+// different form than the zone file has it. Domain names are compared case insensitive and without trailing dot,
+// quoted TXT content is unquoted and IPv6 addresses are compared in their canonical form
+func normaliseContent(recordType, content string) string {
+	content = strings.TrimSpace(content)
+	switch t := strings.ToUpper(recordType); {
+	case t == "TXT" || t == "SPF":
+		if strings.HasPrefix(content, `"`) {
+			if parts, err := parseCharacterStrings(content); err == nil {
+				return strings.Join(parts, "")
+			}
+		}
+		return content
+	case t == "AAAA":
+		if addr, err := netip.ParseAddr(content); err == nil {
+			return addr.String()
+		}
+		return content
+	case nameTypes[t] || t == "MX":
+		return strings.ToLower(strings.TrimSuffix(content, "."))
+	case t == "SRV" || t == "NAPTR":
+		fields := strings.Fields(content)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = strings.ToLower(strings.TrimSuffix(fields[len(fields)-1], "."))
+		}
+		return strings.Join(fields, " ")
+	case t == "SVCB" || t == "HTTPS":
+		fields := strings.Fields(content)
+		if len(fields) > 1 && fields[1] != "." {
+			fields[1] = strings.ToLower(strings.TrimSuffix(fields[1], "."))
+		}
+		return strings.Join(fields, " ")
+	default:
+		return strings.Join(strings.Fields(content), " ")
+	}
+}
@@ -0,0 +1,152 @@
+package zonefile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+// zoneClient serves a single zone with the given records. Only the methods used to plan an import are implemented
+type zoneClient struct {
+	dns.DNSClient
+	zone    *model.Zone
+	records []*model.DNSRecord
+}
+
+func (c *zoneClient) ListZonesByName(ctx context.Context, name string) ([]*model.Zone, error) {
+	if name == c.zone.Name {
+		return []*model.Zone{c.zone}, nil
+	}
+	return nil, nil
+}
+
+func (c *zoneClient) ListRecords(ctx context.Context, zoneID string) ([]*model.DNSRecord, error) {
+	return c.records, nil
+}
+
+func newZoneClient() *zoneClient {
+	return &zoneClient{
+		zone: &model.Zone{ID: "zone-1", Name: "burmudar.dev"},
+		records: []*model.DNSRecord{
+			{ID: "a", ZoneID: "zone-1", Name: "burmudar.dev", Type: "A", Content: "169.0.54.152", TTL: 300, Proxied: true},
+			{ID: "mx", ZoneID: "zone-1", Name: "burmudar.dev", Type: "MX", Content: "mail.burmudar.dev", TTL: 3600, Priority: intPtr(10)},
+			{ID: "txt", ZoneID: "zone-1", Name: "burmudar.dev", Type: "TXT", Content: `"v=spf1 -all"`, TTL: 3600},
+			{ID: "www", ZoneID: "zone-1", Name: "www.burmudar.dev", Type: "CNAME", Content: "burmudar.dev", TTL: 3600},
+		},
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	records := []dns.Record{
+		{Name: "burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300},
+		{Name: "burmudar.dev", Type: "MX", Content: "mail.burmudar.dev", TTL: 3600, Priority: intPtr(10)},
+		{Name: "burmudar.dev", Type: "TXT", Content: "v=spf1 -all", TTL: 300},
+		{Name: "www.burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300},
+		{Name: "media.burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300, Proxied: boolPtr(true)},
+		{Name: "media.burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300, Proxied: boolPtr(true)},
+		{Name: "other.example.com", Type: "A", IP: "192.0.2.1", TTL: 300},
+	}
+
+	t.Run("Conflicts without replace", func(t *testing.T) {
+		changes, conflicts, err := PlanImport(context.Background(), newZoneClient(), "burmudar.dev", records, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		wanted := map[string]dns.Action{
+			"MX burmudar.dev":      dns.ActionUnchanged,
+			"TXT burmudar.dev":     dns.ActionUpdate,
+			"A media.burmudar.dev": dns.ActionCreate,
+		}
+		if len(changes) != len(wanted) {
+			t.Fatalf("Got %d changes. Wanted %d", len(changes), len(wanted))
+		}
+		for _, c := range changes {
+			key := string(c.Record.Type) + " " + c.Record.Name
+			if c.Action != wanted[key] {
+				t.Errorf("Got %s for %s. Wanted %s", c.Action, key, wanted[key])
+			}
+		}
+
+		if len(conflicts) != 3 {
+			t.Fatalf("Got %d conflicts. Wanted 3: %v", len(conflicts), conflicts)
+		}
+		if !errors.Is(conflicts[0], dns.ErrRecordExists) {
+			t.Errorf("Got %v. Wanted the A record with different content to conflict", conflicts[0])
+		}
+		if !errors.Is(conflicts[1], dns.ErrRecordExists) {
+			t.Errorf("Got %v. Wanted the A record next to a CNAME to conflict", conflicts[1])
+		}
+		if errors.Is(conflicts[2], dns.ErrRecordExists) {
+			t.Errorf("Got %v. Wanted a record outside of the zone not to conflict with an existing record", conflicts[2])
+		}
+	})
+
+	t.Run("Replace updates records with different content", func(t *testing.T) {
+		changes, conflicts, err := PlanImport(context.Background(), newZoneClient(), "burmudar.dev", records[:1], ImportOptions{Replace: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(conflicts) != 0 {
+			t.Fatalf("Unexpected conflicts: %v", conflicts)
+		}
+
+		if len(changes) != 1 || changes[0].Action != dns.ActionUpdate {
+			t.Fatalf("Got %v. Wanted a single update", changes)
+		}
+		req := changes[0].Request
+		if req.ID != "a" || req.Content != "169.0.54.153" || !req.Proxied {
+			t.Errorf("Got %+v. Wanted record a updated to 169.0.54.153 and still proxied", req)
+		}
+	})
+
+	t.Run("Invalid content of a new record is a conflict", func(t *testing.T) {
+		invalid := []dns.Record{
+			{Name: "new.burmudar.dev", Type: "A", IP: "2001:db8::1", TTL: 300},
+			{Name: "new.burmudar.dev", Type: "TXT", Content: " ", TTL: 300},
+		}
+
+		changes, conflicts, err := PlanImport(context.Background(), newZoneClient(), "burmudar.dev", invalid, ImportOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(changes) != 0 {
+			t.Errorf("Got %v. Wanted no changes", changes)
+		}
+		if len(conflicts) != 2 {
+			t.Fatalf("Got %d conflicts. Wanted 2: %v", len(conflicts), conflicts)
+		}
+		if !errors.Is(conflicts[0], dns.ErrIPTypeMismatch) {
+			t.Errorf("Got %v. Wanted the IPv6 content of the A record to conflict", conflicts[0])
+		}
+	})
+}
+
+func TestWritePlan(t *testing.T) {
+	records := []dns.Record{
+		{Name: "burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300},
+		{Name: "media.burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300},
+	}
+
+	changes, conflicts, err := PlanImport(context.Background(), newZoneClient(), "burmudar.dev", records, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	WritePlan(buf, changes, conflicts)
+	out := buf.String()
+
+	conflict := "  ! A burmudar.dev conflicts with A burmudar.dev '169.0.54.152': the content differs, use --replace to update it\n"
+	if !strings.Contains(out, conflict) {
+		t.Errorf("Got %q. Wanted it to contain the conflict %q", out, conflict)
+	}
+	if summary := "Plan: 1 to create, 0 to update, 0 unchanged, 1 conflicting.\n"; !strings.HasSuffix(out, summary) {
+		t.Errorf("Got %q. Wanted it to end with %q", out, summary)
+	}
+}
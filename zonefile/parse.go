@@ -0,0 +1,448 @@
+package zonefile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+)
+
+var ErrInvalidZoneFile = errors.New("Invalid zone file")
+
+// Types that are managed by Cloudflare and skipped when parsing a zone file
+var managedTypes = map[string]bool{
+	"SOA": true,
+}
+
+// ParseOptions configures how a zone file is parsed
+type ParseOptions struct {
+	// Origin is the origin relative names are qualified with until the zone file sets one with $ORIGIN
+	Origin string
+	// ForceOrigin ignores $ORIGIN in the zone file, so that a zone file of one zone can be read as the records of
+	// another zone
+	ForceOrigin bool
+}
+
+// Parse reads the records of an RFC 1035 zone file. The content of the records is converted to the form Cloudflare
+// uses: domain names are not fully qualified, TXT content is unquoted and the priority of MX, SRV and URI records is
+// moved to Priority. The comments written by Write are read back into the proxied status and TTL of records. SOA
+// records and the NS records of the origin are skipped, since Cloudflare manages them
+func Parse(r io.Reader, opts ParseOptions) ([]dns.Record, error) {
+	p := parser{origin: strings.TrimSuffix(opts.Origin, "."), forceOrigin: opts.ForceOrigin, ttl: -1}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for {
+		line, start, err := readEntry(scanner, &lineNo)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidZoneFile, start, err)
+		}
+
+		if err := p.parseEntry(line); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidZoneFile, start, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p.records, nil
+}
+
+// entry is a single logical line of a zone file
+type entry struct {
+	tokens []string
+	// indented is true when the entry starts with whitespace, which means it has the name of the previous entry
+	indented bool
+	comment  string
+}
+
+// readEntry reads the next logical line of the zone file, joining the lines of entries that are continued with
+// parentheses. The line number the entry starts on is returned as well
+func readEntry(scanner *bufio.Scanner, lineNo *int) (entry, int, error) {
+	var e entry
+	start := 0
+	depth := 0
+	for scanner.Scan() {
+		*lineNo++
+		line := scanner.Text()
+		if start == 0 {
+			start = *lineNo
+			e.indented = len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+		}
+
+		tokens, comment, d, err := tokenize(line, depth)
+		if err != nil {
+			return entry{}, start, err
+		}
+		e.tokens = append(e.tokens, tokens...)
+		if comment != "" {
+			e.comment = strings.TrimSpace(e.comment + " " + comment)
+		}
+		depth = d
+
+		if depth > 0 {
+			continue
+		}
+		if len(e.tokens) == 0 {
+			// blank lines and comments
+			e, start = entry{}, 0
+			continue
+		}
+		return e, start, nil
+	}
+
+	if depth > 0 {
+		return entry{}, start, fmt.Errorf("unbalanced parentheses")
+	}
+
+	return entry{}, start, io.EOF
+}
+
+// tokenize splits the line into tokens, where quoted strings are single tokens including their quotes. A quote in
+// the middle of a token, like in alpn="h2", is part of the token and the token continues after the closing quote.
+// Parentheses change the depth and are not returned as tokens. The text after ';' is returned as the comment
+func tokenize(line string, depth int) ([]string, string, int, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+	// quotedToken is true when the quoted string started the token, which ends the token at the closing quote
+	quotedToken := false
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes:
+			current.WriteByte(c)
+			if c == '\\' && i+1 < len(line) {
+				i++
+				current.WriteByte(line[i])
+			} else if c == '"' {
+				inQuotes = false
+				if quotedToken {
+					flush()
+				}
+			}
+		case c == '"':
+			inQuotes = true
+			quotedToken = current.Len() == 0
+			current.WriteByte(c)
+		case c == '\\' && i+1 < len(line):
+			current.WriteByte(c)
+			i++
+			current.WriteByte(line[i])
+		case c == ';':
+			flush()
+			return tokens, strings.TrimSpace(line[i+1:]), depth, nil
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			if depth == 0 {
+				return nil, "", 0, fmt.Errorf("unbalanced parentheses")
+			}
+			depth--
+		case c == ' ' || c == '\t':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+
+	if inQuotes {
+		return nil, "", 0, fmt.Errorf("unterminated quoted string")
+	}
+	flush()
+
+	return tokens, "", depth, nil
+}
+
+type parser struct {
+	origin      string
+	forceOrigin bool
+	// ttl is the default TTL set with $TTL, or -1 when there is none
+	ttl      int
+	lastName string
+	lastTTL  int
+	records  []dns.Record
+}
+
+func (p *parser) parseEntry(e entry) error {
+	switch strings.ToUpper(e.tokens[0]) {
+	case "$ORIGIN":
+		if len(e.tokens) != 2 {
+			return fmt.Errorf("$ORIGIN requires a domain name")
+		}
+		if !p.forceOrigin {
+			p.origin = strings.TrimSuffix(p.qualify(e.tokens[1]), ".")
+		}
+		return nil
+	case "$TTL":
+		if len(e.tokens) != 2 {
+			return fmt.Errorf("$TTL requires a TTL")
+		}
+		ttl, err := parseTTL(e.tokens[1])
+		if err != nil {
+			return err
+		}
+		p.ttl = ttl
+		return nil
+	case "$INCLUDE", "$GENERATE":
+		return fmt.Errorf("%s is not supported", e.tokens[0])
+	}
+
+	tokens := e.tokens
+	name := p.lastName
+	if !e.indented {
+		name = strings.TrimSuffix(p.qualify(tokens[0]), ".")
+		tokens = tokens[1:]
+	}
+	if name == "" {
+		return fmt.Errorf("the record has no name")
+	}
+	p.lastName = name
+
+	ttl := -1
+	// the TTL and class are optional and can be in either order
+	for len(tokens) > 0 {
+		if strings.EqualFold(tokens[0], "IN") {
+			tokens = tokens[1:]
+		} else if isClass(tokens[0]) {
+			return fmt.Errorf("class %s is not supported, only IN", tokens[0])
+		} else if t, err := parseTTL(tokens[0]); err == nil && ttl < 0 {
+			ttl = t
+			tokens = tokens[1:]
+		} else {
+			break
+		}
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("the record of %s has no type", name)
+	}
+
+	recordType := strings.ToUpper(tokens[0])
+	data := tokens[1:]
+	if len(data) == 0 {
+		return fmt.Errorf("%s record %s has no data", recordType, name)
+	}
+
+	switch {
+	case ttl >= 0:
+	case p.ttl >= 0:
+		ttl = p.ttl
+	case p.lastTTL > 0:
+		ttl = p.lastTTL
+	default:
+		return fmt.Errorf("%s record %s has no TTL and there is no $TTL", recordType, name)
+	}
+	p.lastTTL = ttl
+
+	if managedTypes[recordType] || (recordType == "NS" && strings.EqualFold(name, p.origin)) {
+		return nil
+	}
+
+	record := dns.Record{
+		ZoneName: p.origin,
+		Type:     dns.ZoneType(recordType),
+		Name:     name,
+		TTL:      ttl,
+	}
+	if err := p.parseData(&record, data); err != nil {
+		return err
+	}
+	if err := parseComment(&record, e.comment); err != nil {
+		return err
+	}
+
+	p.records = append(p.records, record)
+	return nil
+}
+
+// parseData sets the content and priority of the record from the record data
+func (p *parser) parseData(record *dns.Record, data []string) error {
+	t := string(record.Type)
+	invalid := func() error {
+		return fmt.Errorf("invalid data '%s' of %s record %s", strings.Join(data, " "), t, record.Name)
+	}
+
+	switch {
+	case record.Type.IsAddress():
+		if len(data) != 1 {
+			return invalid()
+		}
+		record.IP = data[0]
+	case nameTypes[t]:
+		if len(data) != 1 {
+			return invalid()
+		}
+		record.Content = p.contentName(data[0])
+	case t == "TXT" || t == "SPF":
+		var content strings.Builder
+		for _, d := range data {
+			if !strings.HasPrefix(d, `"`) {
+				content.WriteString(d)
+				continue
+			}
+			s, _, err := unquote(d)
+			if err != nil {
+				return err
+			}
+			content.WriteString(s)
+		}
+		record.Content = content.String()
+	case t == "MX":
+		if len(data) != 2 {
+			return invalid()
+		}
+		if err := setPriority(record, data[0]); err != nil {
+			return invalid()
+		}
+		record.Content = p.contentName(data[1])
+	case t == "SRV":
+		if len(data) != 4 {
+			return invalid()
+		}
+		if err := setPriority(record, data[0]); err != nil {
+			return invalid()
+		}
+		record.Content = strings.Join([]string{data[1], data[2], p.contentName(data[3])}, " ")
+	case t == "URI":
+		if len(data) != 3 {
+			return invalid()
+		}
+		if err := setPriority(record, data[0]); err != nil {
+			return invalid()
+		}
+		record.Content = strings.Join(data[1:], " ")
+	case t == "SVCB" || t == "HTTPS":
+		// the priority stays part of the content, only the TargetName is a domain name
+		if len(data) < 2 {
+			return invalid()
+		}
+		fields := append([]string{data[0], p.contentName(data[1])}, data[2:]...)
+		record.Content = strings.Join(fields, " ")
+	case t == "NAPTR":
+		if len(data) != 6 {
+			return invalid()
+		}
+		record.Content = strings.Join(append(data[:5:5], p.contentName(data[5])), " ")
+	default:
+		record.Content = strings.Join(data, " ")
+	}
+
+	return nil
+}
+
+func setPriority(record *dns.Record, value string) error {
+	priority, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	p := int(priority)
+	record.Priority = &p
+	return nil
+}
+
+// parseComment reads the Cloudflare settings written by Write from the comment of a record. Other comments are
+// ignored
+func parseComment(record *dns.Record, comment string) error {
+	for _, field := range strings.Fields(comment) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "proxied":
+			proxied, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid proxied status '%s' of %s record %s", value, record.Type, record.Name)
+			}
+			record.Proxied = &proxied
+		case "ttl":
+			if value == "auto" {
+				record.TTL = AutoTTL
+			}
+		}
+	}
+
+	return nil
+}
+
+// qualify returns the fully qualified name, with a trailing dot, of a name in the zone file
+func (p *parser) qualify(name string) string {
+	switch {
+	case name == "@":
+		return p.origin + "."
+	case strings.HasSuffix(name, "."):
+		return name
+	case p.origin == "":
+		return name + "."
+	default:
+		return name + "." + p.origin + "."
+	}
+}
+
+// contentName returns a domain name in record data as Cloudflare stores it, fully qualified without a trailing dot.
+// The root name '.' is kept as is
+func (p *parser) contentName(name string) string {
+	if name == "." {
+		return name
+	}
+
+	return strings.TrimSuffix(p.qualify(name), ".")
+}
+
+// parseTTL parses a TTL in seconds, or with the BIND units s, m, h, d and w like 1h30m
+func parseTTL(s string) (int, error) {
+	if n, err := strconv.ParseUint(s, 10, 31); err == nil {
+		return int(n), nil
+	}
+
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	total, value, digits := 0, 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isDigit(c) {
+			value = value*10 + int(c-'0')
+			digits++
+			continue
+		}
+
+		unit, ok := units[c|0x20]
+		if !ok || digits == 0 {
+			return 0, fmt.Errorf("invalid TTL '%s'", s)
+		}
+		total += value * unit
+		value, digits = 0, 0
+	}
+	if digits > 0 || total == 0 && len(s) == 0 {
+		return 0, fmt.Errorf("invalid TTL '%s'", s)
+	}
+
+	return total, nil
+}
+
+func isClass(s string) bool {
+	switch strings.ToUpper(s) {
+	case "CH", "HS", "CS":
+		return true
+	}
+
+	return false
+}
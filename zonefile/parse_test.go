@@ -0,0 +1,175 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/burmudar/cloudflare-dns/dns"
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestParse(t *testing.T) {
+	zone := `$ORIGIN burmudar.dev.
+$TTL 1h
+@	IN	SOA	ns1.burmudar.dev. hostmaster.burmudar.dev. (
+		2023050101 ; serial
+		7200 3600 1209600 300 )
+@		NS	ns1.example.net.
+@	300	IN	A	169.0.54.153 ; proxied=true
+	IN	MX	10 mail
+www	1d	CNAME	@ ; proxied=false ttl=auto
+_sip._tcp	SRV	10 1 5060 sip.example.net.
+txt	TXT	"v=spf1 \"quoted\"" " -all"
+@	HTTPS	1 . alpn="h3,h2" ipv4hint=169.0.54.153
+svc	SVCB	1 target alpn="h2" port=8443
+sip	NAPTR	100 10 "S" "SIP+D2U" "" _sip._udp
+sub	NS	ns1.example.net.
+`
+
+	records, err := Parse(strings.NewReader(zone), ParseOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wanted := []dns.Record{
+		{ZoneName: "burmudar.dev", Name: "burmudar.dev", Type: "A", IP: "169.0.54.153", TTL: 300, Proxied: boolPtr(true)},
+		{ZoneName: "burmudar.dev", Name: "burmudar.dev", Type: "MX", Content: "mail.burmudar.dev", TTL: 3600, Priority: intPtr(10)},
+		{ZoneName: "burmudar.dev", Name: "www.burmudar.dev", Type: "CNAME", Content: "burmudar.dev", TTL: AutoTTL, Proxied: boolPtr(false)},
+		{ZoneName: "burmudar.dev", Name: "_sip._tcp.burmudar.dev", Type: "SRV", Content: "1 5060 sip.example.net", TTL: 3600, Priority: intPtr(10)},
+		{ZoneName: "burmudar.dev", Name: "txt.burmudar.dev", Type: "TXT", Content: `v=spf1 "quoted" -all`, TTL: 3600},
+		{ZoneName: "burmudar.dev", Name: "burmudar.dev", Type: "HTTPS", Content: `1 . alpn="h3,h2" ipv4hint=169.0.54.153`, TTL: 3600},
+		{ZoneName: "burmudar.dev", Name: "svc.burmudar.dev", Type: "SVCB", Content: `1 target.burmudar.dev alpn="h2" port=8443`, TTL: 3600},
+		{ZoneName: "burmudar.dev", Name: "sip.burmudar.dev", Type: "NAPTR", Content: `100 10 "S" "SIP+D2U" "" _sip._udp.burmudar.dev`, TTL: 3600},
+		{ZoneName: "burmudar.dev", Name: "sub.burmudar.dev", Type: "NS", Content: "ns1.example.net", TTL: 3600},
+	}
+
+	if !reflect.DeepEqual(records, wanted) {
+		t.Errorf("Got:\n%+v\nWanted:\n%+v", records, wanted)
+	}
+}
+
+func TestParseForceOrigin(t *testing.T) {
+	zone := "$ORIGIN burmudar.dev.\n$TTL 300\nmedia A 169.0.54.153\nother.example.com. A 192.0.2.1\n"
+
+	records, err := Parse(strings.NewReader(zone), ParseOptions{Origin: "example.com", ForceOrigin: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(records) != 2 || records[0].Name != "media.example.com" || records[1].Name != "other.example.com" {
+		t.Errorf("Got %+v. Wanted media.example.com and other.example.com", records)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, zone := range []string{
+		"$TTL 300\n@ A 192.0.2.1\n",
+		"$ORIGIN burmudar.dev.\n@ A 192.0.2.1\n",
+		"$ORIGIN burmudar.dev.\n$TTL 300\n@ CH A 192.0.2.1\n",
+		"$ORIGIN burmudar.dev.\n$TTL 300\n@ TXT \"unterminated\n",
+		"$ORIGIN burmudar.dev.\n$TTL 300\n@ MX mail\n",
+		"$ORIGIN burmudar.dev.\n$TTL 300\n@ SOA ns1 hostmaster ( 1 2 3 4 5\n",
+		"$INCLUDE other.zone\n",
+	} {
+		if _, err := Parse(strings.NewReader(zone), ParseOptions{}); !errors.Is(err, ErrInvalidZoneFile) {
+			t.Errorf("Got %v. Wanted %v for:\n%s", err, ErrInvalidZoneFile, zone)
+		}
+	}
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	exported := []*model.DNSRecord{
+		{Name: "burmudar.dev", Type: "A", Content: "169.0.54.153", TTL: AutoTTL, Proxiable: true, Proxied: true},
+		{Name: "burmudar.dev", Type: "MX", Content: "mail.burmudar.dev", TTL: 3600, Priority: intPtr(5)},
+		{Name: "burmudar.dev", Type: "TXT", Content: "v=spf1 include:\"_spf.example.com\" ; -all\\" + strings.Repeat("x", 300), TTL: 3600},
+		{Name: "_sip._tcp.burmudar.dev", Type: "SRV", Content: "1 5060 sip.burmudar.dev", TTL: 3600, Priority: intPtr(10)},
+		{Name: "www.burmudar.dev", Type: "CNAME", Content: "burmudar.dev", TTL: 300, Proxiable: true},
+		{Name: "burmudar.dev", Type: "CAA", Content: `0 issue "letsencrypt.org"`, TTL: 3600},
+		{Name: "burmudar.dev", Type: "HTTPS", Content: `1 . alpn="h3,h2"`, TTL: 3600},
+		{Name: "svc.burmudar.dev", Type: "SVCB", Content: `1 target.example.com alpn="h2" port=8443`, TTL: 3600},
+		{Name: "sip.burmudar.dev", Type: "NAPTR", Content: `100 10 "S" "SIP+D2U" "" _sip._udp.burmudar.dev`, TTL: 3600},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "burmudar.dev", exported); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	records, err := Parse(&buf, ParseOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing:\n%s\n%v", buf.String(), err)
+	}
+	if len(records) != len(exported) {
+		t.Fatalf("Got %d records. Wanted %d", len(records), len(exported))
+	}
+
+	for _, e := range exported {
+		found := false
+		for _, r := range records {
+			if r.Name != e.Name || string(r.Type) != e.Type {
+				continue
+			}
+			found = true
+			if contentOf(r) != e.Content || r.TTL != e.TTL {
+				t.Errorf("Got content %q and TTL %d for %s %s. Wanted %q and %d", contentOf(r), r.TTL, e.Type, e.Name, e.Content, e.TTL)
+			}
+			if e.Priority != nil && (r.Priority == nil || *r.Priority != *e.Priority) {
+				t.Errorf("Got priority %v for %s %s. Wanted %d", r.Priority, e.Type, e.Name, *e.Priority)
+			}
+			if e.Proxiable && (r.Proxied == nil || *r.Proxied != e.Proxied) {
+				t.Errorf("Got proxied %v for %s %s. Wanted %t", r.Proxied, e.Type, e.Name, e.Proxied)
+			}
+		}
+		if !found {
+			t.Errorf("%s %s was not parsed", e.Type, e.Name)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	for _, tc := range []struct {
+		line   string
+		wanted []string
+	}{
+		{`@ TXT "one" "two"`, []string{"@", "TXT", `"one"`, `"two"`}},
+		{`@ HTTPS 1 . alpn="h3,h2" port=443`, []string{"@", "HTTPS", "1", ".", `alpn="h3,h2"`, "port=443"}},
+		{`@ SVCB 1 . key="a b"c`, []string{"@", "SVCB", "1", ".", `key="a b"c`}},
+		{`@ NAPTR 100 10 "S" "" .`, []string{"@", "NAPTR", "100", "10", `"S"`, `""`, "."}},
+	} {
+		tokens, _, _, err := tokenize(tc.line, 0)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tc.line, err)
+		} else if !reflect.DeepEqual(tokens, tc.wanted) {
+			t.Errorf("Got %q. Wanted %q for %q", tokens, tc.wanted, tc.line)
+		}
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		wanted int
+		err    bool
+	}{
+		{"300", 300, false},
+		{"1h", 3600, false},
+		{"1h30m", 5400, false},
+		{"1W", 604800, false},
+		{"", 0, true},
+		{"h", 0, true},
+		{"1h30", 0, true},
+		{"A", 0, true},
+	} {
+		got, err := parseTTL(tc.value)
+		if (err != nil) != tc.err || got != tc.wanted {
+			t.Errorf("Got %d, %v. Wanted %d and error %t for %q", got, err, tc.wanted, tc.err, tc.value)
+		}
+	}
+}
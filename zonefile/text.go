@@ -0,0 +1,67 @@
+package zonefile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseCharacterStrings parses a list of quoted character-strings separated by whitespace, like the data of a TXT
+// record. Escaped characters, both '\"' and '\DDD', are unescaped
+func parseCharacterStrings(s string) ([]string, error) {
+	var parts []string
+	s = strings.TrimSpace(s)
+	for len(s) > 0 {
+		if s[0] != '"' {
+			return nil, fmt.Errorf("expected a quoted string at '%s'", s)
+		}
+
+		part, rest, err := unquote(s)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+
+		if len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t' {
+			return nil, fmt.Errorf("expected whitespace after a quoted string at '%s'", rest)
+		}
+		s = strings.TrimSpace(rest)
+	}
+
+	return parts, nil
+}
+
+// unquote unquotes the character-string at the start of s, which starts with a quote. The rest of s after the
+// closing quote is returned as well
+func unquote(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated escape in %s", s)
+			}
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				n, _ := strconv.Atoi(s[i+1 : i+4])
+				if n > 255 {
+					return "", "", fmt.Errorf("invalid escape \\%s in %s", s[i+1:i+4], s)
+				}
+				b.WriteByte(byte(n))
+				i += 3
+			} else {
+				b.WriteByte(s[i+1])
+				i++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quoted string %s", s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,241 @@
+// Package zonefile converts Cloudflare DNS records to and from RFC 1035 zone files
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+// AutoTTL is the TTL Cloudflare uses for records with an automatic TTL
+const AutoTTL = 1
+
+// AutoTTLSeconds is the TTL written for records with an automatic TTL, which is what Cloudflare serves them with
+const AutoTTLSeconds = 300
+
+// DefaultTTL is the $TTL of a zone without records
+const DefaultTTL = 3600
+
+// maxCharacterString is the maximum length of a single character-string of a TXT record
+const maxCharacterString = 255
+
+// Types whose whole content is a domain name
+var nameTypes = map[string]bool{
+	"CNAME": true,
+	"DNAME": true,
+	"NS":    true,
+	"PTR":   true,
+}
+
+// Write writes the records of the zone origin as a zone file. Cloudflare specific settings that have no place in a
+// zone file, like the proxied status and automatic TTLs, are written as comments after the record. Cloudflare does
+// not return the SOA record of a zone, so the zone file has none
+func Write(w io.Writer, origin string, records []*model.DNSRecord) error {
+	origin = strings.TrimSuffix(origin, ".")
+
+	sorted := make([]*model.DNSRecord, len(records))
+	copy(sorted, records)
+	// records at the apex come first, followed by the other records by name
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := relativeName(origin, sorted[i].Name), relativeName(origin, sorted[j].Name)
+		if a != b {
+			return a == "@" || (b != "@" && a < b)
+		}
+		return sorted[i].Type < sorted[j].Type
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; %s exported from Cloudflare on %s\n", origin, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", origin)
+	fmt.Fprintf(bw, "$TTL %d\n", defaultTTL(sorted))
+
+	for _, r := range sorted {
+		rdata, err := rdata(r)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s", relativeName(origin, r.Name), ttlSeconds(r.TTL), strings.ToUpper(r.Type), rdata)
+		if comment := comment(r); comment != "" {
+			fmt.Fprintf(bw, " ; %s", comment)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	return bw.Flush()
+}
+
+// defaultTTL returns the most common TTL of the records
+func defaultTTL(records []*model.DNSRecord) int {
+	counts := make(map[int]int)
+	best := DefaultTTL
+	for _, r := range records {
+		ttl := ttlSeconds(r.TTL)
+		counts[ttl]++
+		if counts[ttl] > counts[best] || (counts[ttl] == counts[best] && ttl < best) {
+			best = ttl
+		}
+	}
+
+	return best
+}
+
+func ttlSeconds(ttl int) int {
+	if ttl == AutoTTL {
+		return AutoTTLSeconds
+	}
+
+	return ttl
+}
+
+// relativeName returns the name relative to origin, where '@' is the origin itself. Names outside of origin are
+// written fully qualified
+func relativeName(origin, name string) string {
+	name = strings.TrimSuffix(name, ".")
+	switch {
+	case strings.EqualFold(name, origin):
+		return "@"
+	case strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(origin)):
+		return name[:len(name)-len(origin)-1]
+	default:
+		return name + "."
+	}
+}
+
+// absoluteName returns the name with a trailing dot, so that it is not made relative to the origin
+func absoluteName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// comment returns the Cloudflare settings of the record that are kept as a comment
+func comment(r *model.DNSRecord) string {
+	var settings []string
+	if r.Proxiable || r.Proxied {
+		settings = append(settings, "proxied="+strconv.FormatBool(r.Proxied))
+	}
+	if r.TTL == AutoTTL {
+		settings = append(settings, "ttl=auto")
+	}
+
+	return strings.Join(settings, " ")
+}
+
+// rdata returns the record data of the record in presentation format. The content Cloudflare returns is already in
+// presentation format for most types, except that domain names are not fully qualified, TXT content might not be
+// quoted and the priority of MX, SRV and URI records is a separate field. Domain names are written fully qualified,
+// so that they are not made relative to $ORIGIN when the zone file is read
+func rdata(r *model.DNSRecord) (string, error) {
+	t := strings.ToUpper(r.Type)
+	content := strings.TrimSpace(r.Content)
+	fields := strings.Fields(content)
+
+	priority := 0
+	if r.Priority != nil {
+		priority = *r.Priority
+	}
+
+	switch {
+	case nameTypes[t]:
+		return absoluteName(content), nil
+	case t == "TXT" || t == "SPF":
+		return quoteTXT(content), nil
+	case t == "MX":
+		if len(fields) == 2 {
+			return fmt.Sprintf("%s %s", fields[0], absoluteName(fields[1])), nil
+		} else if len(fields) != 1 {
+			return "", fmt.Errorf("invalid content '%s' of MX record %s", content, r.Name)
+		}
+		return fmt.Sprintf("%d %s", priority, absoluteName(content)), nil
+	case t == "SRV":
+		if len(fields) == 3 {
+			fields = append([]string{strconv.Itoa(priority)}, fields...)
+		} else if len(fields) != 4 {
+			return "", fmt.Errorf("invalid content '%s' of SRV record %s", content, r.Name)
+		}
+		fields[3] = absoluteName(fields[3])
+		return strings.Join(fields, " "), nil
+	case t == "URI":
+		if len(fields) == 0 {
+			return "", fmt.Errorf("invalid content '%s' of URI record %s", content, r.Name)
+		}
+		weight, target := fields[0], strings.TrimSpace(strings.TrimPrefix(content, fields[0]))
+		if len(fields) == 3 {
+			// the content already starts with the priority
+			return fmt.Sprintf("%s %s %s", fields[0], fields[1], quoteString(strings.Trim(fields[2], `"`))), nil
+		}
+		return fmt.Sprintf("%d %s %s", priority, weight, quoteString(strings.Trim(target, `"`))), nil
+	case t == "SVCB" || t == "HTTPS":
+		// the TargetName follows the priority and is followed by the SvcParams
+		if len(fields) < 2 {
+			return "", fmt.Errorf("invalid content '%s' of %s record %s", content, t, r.Name)
+		}
+		params := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(content, fields[0])), fields[1]))
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", fields[0], absoluteName(fields[1]), params)), nil
+	case t == "NAPTR":
+		// the replacement is the last field and never quoted, while the fields before it might contain spaces
+		if len(fields) < 6 {
+			return "", fmt.Errorf("invalid content '%s' of NAPTR record %s", content, r.Name)
+		}
+		replacement := fields[len(fields)-1]
+		return fmt.Sprintf("%s %s", strings.TrimSpace(strings.TrimSuffix(content, replacement)), absoluteName(replacement)), nil
+	default:
+		return content, nil
+	}
+}
+
+// quoteTXT returns the content of a TXT record as quoted character-strings. Content that is already quoted is
+// returned as is, other content is split into strings of at most 255 bytes
+func quoteTXT(content string) string {
+	if strings.HasPrefix(content, `"`) {
+		if _, err := parseCharacterStrings(content); err == nil {
+			return content
+		}
+	}
+
+	if content == "" {
+		return `""`
+	}
+
+	var parts []string
+	for len(content) > 0 {
+		n := len(content)
+		if n > maxCharacterString {
+			n = maxCharacterString
+		}
+		parts = append(parts, quoteString(content[:n]))
+		content = content[n:]
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// quoteString quotes s as a single character-string, escaping quotes, backslashes and non printable bytes
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/burmudar/cloudflare-dns/dns/cloudflare/model"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestWrite(t *testing.T) {
+	records := []*model.DNSRecord{
+		{Name: "media.burmudar.dev", Type: "A", Content: "169.0.54.153", TTL: 3600, Proxiable: true, Proxied: true},
+		{Name: "burmudar.dev", Type: "AAAA", Content: "2001:db8::1", TTL: AutoTTL, Proxiable: true},
+		{Name: "www.burmudar.dev", Type: "CNAME", Content: "burmudar.dev", TTL: 3600, Proxiable: true},
+		{Name: "burmudar.dev", Type: "MX", Content: "mail.burmudar.dev", TTL: 3600, Priority: intPtr(5)},
+		{Name: "_sip._tcp.burmudar.dev", Type: "SRV", Content: "1 5060 sip.burmudar.dev", TTL: 3600, Priority: intPtr(10)},
+		{Name: "burmudar.dev", Type: "TXT", Content: `v=spf1 include:"_spf.example.com" -all`, TTL: 300},
+		{Name: "quoted.burmudar.dev", Type: "TXT", Content: `"part one" "part two"`, TTL: 3600},
+		{Name: "burmudar.dev", Type: "CAA", Content: `0 issue "letsencrypt.org"`, TTL: 3600},
+		{Name: "other.example.com", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{Name: "burmudar.dev", Type: "HTTPS", Content: `1 . alpn="h3,h2"`, TTL: 3600},
+		{Name: "svc.burmudar.dev", Type: "HTTPS", Content: `1 target.example.com alpn="h2" port=8443`, TTL: 3600},
+		{Name: "alias.burmudar.dev", Type: "SVCB", Content: "0 svc.example.net", TTL: 3600},
+		{Name: "burmudar.dev", Type: "NAPTR", Content: `100 10 "S" "SIP+D2U" "" _sip._udp.burmudar.dev`, TTL: 3600},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "burmudar.dev", records); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wanted := []string{
+		"$ORIGIN burmudar.dev.",
+		"$TTL 3600",
+		"@\t300\tIN\tAAAA\t2001:db8::1 ; proxied=false ttl=auto",
+		"@\t3600\tIN\tCAA\t0 issue \"letsencrypt.org\"",
+		"@\t3600\tIN\tHTTPS\t1 . alpn=\"h3,h2\"",
+		"@\t3600\tIN\tMX\t5 mail.burmudar.dev.",
+		"@\t3600\tIN\tNAPTR\t100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.burmudar.dev.",
+		"@\t300\tIN\tTXT\t\"v=spf1 include:\\\"_spf.example.com\\\" -all\"",
+		"_sip._tcp\t3600\tIN\tSRV\t10 1 5060 sip.burmudar.dev.",
+		"alias\t3600\tIN\tSVCB\t0 svc.example.net.",
+		"media\t3600\tIN\tA\t169.0.54.153 ; proxied=true",
+		"other.example.com.\t3600\tIN\tA\t192.0.2.1",
+		"quoted\t3600\tIN\tTXT\t\"part one\" \"part two\"",
+		"svc\t3600\tIN\tHTTPS\t1 target.example.com. alpn=\"h2\" port=8443",
+		"www\t3600\tIN\tCNAME\tburmudar.dev. ; proxied=false",
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !strings.HasPrefix(lines[0], ";") {
+		t.Errorf("Got first line %q. Wanted a comment", lines[0])
+	}
+	if got := strings.Join(lines[1:], "\n"); got != strings.Join(wanted, "\n") {
+		t.Errorf("Got:\n%s\nWanted:\n%s", got, strings.Join(wanted, "\n"))
+	}
+}
+
+func TestQuoteTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for _, tc := range []struct {
+		content string
+		wanted  string
+	}{
+		{"", `""`},
+		{"hello world", `"hello world"`},
+		{`back\slash`, `"back\\slash"`},
+		{"tab\there", `"tab\009here"`},
+		{`"already" "quoted"`, `"already" "quoted"`},
+		{`"unbalanced`, `"\"unbalanced"`},
+		{long, `"` + long[:255] + `" "` + long[255:] + `"`},
+	} {
+		if got := quoteTXT(tc.content); got != tc.wanted {
+			t.Errorf("Got %s. Wanted %s for %q", got, tc.wanted, tc.content)
+		}
+
+		parts, err := parseCharacterStrings(quoteTXT(tc.content))
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", quoteTXT(tc.content), err)
+		} else if got := strings.Join(parts, ""); got != tc.content && !strings.HasPrefix(tc.content, `"already`) {
+			t.Errorf("Got %q after a round-trip. Wanted %q", got, tc.content)
+		}
+	}
+}